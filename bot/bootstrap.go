@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultFirstRunCutoff is how far back the first weekly run goes when no cutoff is given.
+const DefaultFirstRunCutoff = "7 days ago"
+
+// HasState is true when the bot has saved a run, so it does not need RunInit.
+func (b *Bot) HasState() (bool, error) {
+	state, err := b.loadState()
+	if err != nil {
+		return false, err
+	}
+	return state.lastRun() != nil, nil
+}
+
+// RunInit records a baseline in the state file, so that the first weekly run only posts the
+// emojis uploaded after the cutoff instead of every emoji ever. The cutoff is a date or an age
+// that ParseCutoff accepts, and defaults to DefaultFirstRunCutoff.
+func (b *Bot) RunInit(cutoffValue string, force bool) error {
+	state, err := b.loadState()
+	if err != nil {
+		return err
+	}
+	if run := state.lastRun(); run != nil && !force {
+		return fmt.Errorf("the bot already has state from a run at %v, use -force to start over", run.Time.Format(time.RFC1123))
+	}
+
+	if cutoffValue == "" {
+		cutoffValue = DefaultFirstRunCutoff
+	}
+	location, err := b.config.Location()
+	if err != nil {
+		return err
+	}
+	cutoff, err := ParseCutoff(cutoffValue, b.now(), location)
+	if err != nil {
+		return err
+	}
+
+	baseline := &runRecord{Time: b.now()}
+	firstEmoji, err := b.lastEmojiBefore(cutoff)
+	if err != nil {
+		return err
+	}
+	// The cutoff is used instead of the upload time of the emoji, since the
+	// upload times are not known for the emojis from before the bot started.
+	baseline.StartEmojiCreated = cutoff.Unix()
+	baseline.LastNewEmojiCreated = cutoff.Unix()
+	if firstEmoji != nil {
+		baseline.StartEmoji = firstEmoji.Name
+		baseline.LastNewEmoji = firstEmoji.Name
+		fmt.Fprintf(b.out, "The next weekly run will post the emojis uploaded after %v. The last emoji before that is :%v:.\n",
+			cutoff.Format(time.RFC1123), firstEmoji.Name)
+	} else {
+		fmt.Fprintf(b.out, "No emojis were uploaded before %v, so the next weekly run will post every emoji.\n", cutoff.Format(time.RFC1123))
+	}
+	fmt.Fprintln(b.out, "There is no vote from last week yet, so the next weekly run will skip the top emojis from last week.")
+	return b.recordRun(baseline)
+}
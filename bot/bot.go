@@ -0,0 +1,208 @@
+// Package bot posts the new custom emojis of a Slack workspace, the votes for them and the top uploaders.
+// A Bot holds everything one workspace needs, so several bots can run side by side in one process.
+package bot
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// SlackClient is the part of the Slack Web API that the bot uses. *slack.Client implements it.
+type SlackClient interface {
+	PostMessage(channelID string, options ...slack.MsgOption) (string, string, error)
+	UpdateMessage(channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error)
+	DeleteMessage(channel, messageTimestamp string) (string, string, error)
+	GetConversations(params *slack.GetConversationsParameters) ([]slack.Channel, string, error)
+	GetConversationHistory(params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error)
+	GetUsersInfo(users ...string) (*[]slack.User, error)
+	GetEmoji() (map[string]string, error)
+	OpenView(triggerID string, view slack.ModalViewRequest) (*slack.ViewResponse, error)
+}
+
+// Clock tells the bot what time it is.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+type Bot struct {
+	config *Config
+	// Every call to Slack goes through retrier, including the ones that do not use the Slack client.
+	slack       SlackClient
+	retrier     *retrier
+	emojiSource EmojiSource
+	// Set by WithVoteTally, otherwise vote_tally picks the tally.
+	tally VoteTally
+	clock Clock
+	// Where reports go, by the names that routes use.
+	sinks map[string]Sink
+	// Where messages that are only printed go, along with the progress of a run.
+	out     io.Writer
+	printer *message.Printer
+
+	// Where the snapshots, images and state are saved, ending in a slash.
+	dataDir string
+	// The ID of config.EmojiChannel once it has been looked up.
+	channelID string
+	// Held during a run, so that scheduled runs and the runs that reviewers start do not overlap.
+	runLock sync.Mutex
+	// How to make each pending preview again after the skip list is edited, by review ID.
+	reruns map[string]func() error
+	// The history database, once it is opened, and the lock that opens and closes it.
+	historyDB   *bolt.DB
+	historyLock sync.Mutex
+	// Each of these guards one file in dataDir, so that events and reviews that come in at the same time
+	// do not write over each other.
+	emojiEventsLock   sync.Mutex
+	voteReactionsLock sync.Mutex
+	preferencesLock   sync.Mutex
+	// Also keeps two reviewers from posting the same preview at the same time.
+	reviewLock sync.Mutex
+	// When Socket Mode connected, or zero while it is not connected. serve has seen every event since then.
+	listening     time.Time
+	listeningLock sync.Mutex
+
+	// The rest is the state of one run, cleared by resetRunState.
+	lastNewEmoji, previousLastNewEmoji string
+	// The upload times of lastNewEmoji and previousLastNewEmoji, as unix seconds. These are 0 when
+	// only the names are known, like when the last emoji was found by reading the channel.
+	lastNewEmojiCreated, previousLastNewEmojiCreated int64
+	// Set by SetReportWindow to make the report for that window instead of for the last week.
+	reportSince, reportUntil time.Time
+	reactionMessage          *slack.Message
+	// The newest of the new emojis that skip_duplicate_images left out.
+	newestSkippedEmoji *Emoji
+	// previousRun is the saved state of the last run, if there is one. thisRun is saved at the end of this run.
+	previousRun, thisRun *runRecord
+	// What this run has posted so far, and the step that is running. Nil when the run is not journaled.
+	journal     *runJournal
+	currentStep *journalStep
+	// How many messages the current step has sent.
+	stepMessages int
+	// With --redo, the steps of the run that is redone. Their messages are edited or deleted.
+	redoSteps []*journalStep
+	// What a print_everything run would post. Nil in the other modes.
+	transcript *transcript
+	// True while an approved preview is posted. The messages go where full_send sends them.
+	approving bool
+}
+
+// Option changes how New sets up a Bot.
+type Option func(b *Bot)
+
+// WithSlackClient replaces the Slack client made from bot_oauth_token.
+func WithSlackClient(client SlackClient) Option {
+	return func(b *Bot) { b.slack = client }
+}
+
+// WithEmojiSource replaces the emoji source from emoji_source.
+func WithEmojiSource(source EmojiSource) Option {
+	return func(b *Bot) { b.emojiSource = source }
+}
+
+// WithVoteTally replaces the tally from vote_tally.
+func WithVoteTally(tally VoteTally) Option {
+	return func(b *Bot) { b.tally = tally }
+}
+
+// WithClock replaces the system clock.
+func WithClock(clock Clock) Option {
+	return func(b *Bot) { b.clock = clock }
+}
+
+// WithOutput sets where printed messages and progress go. Defaults to stdout.
+func WithOutput(out io.Writer) Option {
+	return func(b *Bot) { b.out = out }
+}
+
+// New makes a Bot for the config. The config is checked and normalized, like LoadConfig does.
+func New(config *Config, options ...Option) (*Bot, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+	config.normalize()
+	dataDir, err := config.dataDir()
+	if err != nil {
+		return nil, err
+	}
+	b := &Bot{
+		config:    config,
+		clock:     realClock{},
+		out:       os.Stdout,
+		printer:   message.NewPrinter(language.English),
+		dataDir:   strings.TrimSuffix(dataDir, "/") + "/",
+		channelID: config.CachedChannelID,
+		sinks:     map[string]Sink{},
+		reruns:    map[string]func() error{},
+	}
+	for _, option := range options {
+		option(b)
+	}
+	if b.slack == nil {
+		b.slack = slack.New(config.BotOauthToken)
+	}
+	b.retrier = newRetrier(b.out, b.clock)
+	b.slack = &retryingClient{client: b.slack, retrier: b.retrier}
+	if source, ok := b.emojiSource.(*adminListSource); ok && source.retrier == nil {
+		source.retrier = b.retrier
+	}
+	if b.emojiSource == nil {
+		b.emojiSource, err = b.newEmojiSource()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name, sink := range b.newSinks() {
+		if _, ok := b.sinks[name]; !ok {
+			b.sinks[name] = sink
+		}
+	}
+	for typeName, names := range config.Routes {
+		for _, name := range names {
+			if _, ok := b.sinks[name]; !ok {
+				return nil, fmt.Errorf("routes for %v has sink %q, which is not in sinks", typeName, name)
+			}
+		}
+	}
+	return b, nil
+}
+
+// Close closes the files that the bot keeps open. The bot opens them again if it is used after.
+func (b *Bot) Close() error {
+	return b.closeHistory()
+}
+
+// Config returns the config of the bot. Changes to it apply to the next run.
+func (b *Bot) Config() *Config {
+	return b.config
+}
+
+// SetReportWindow makes the next runs report the emojis uploaded in the window instead of
+// the ones since the last run. Either end can be zero. These runs are not saved to the state.
+func (b *Bot) SetReportWindow(since, until time.Time) {
+	b.reportSince = since
+	b.reportUntil = until
+}
+
+func (b *Bot) now() time.Time {
+	return b.clock.Now()
+}
+
+func (b *Bot) since(t time.Time) time.Duration {
+	return b.now().Sub(t)
+}
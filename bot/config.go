@@ -0,0 +1,480 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ryho/slack-emoji-bot/util"
+)
+
+// Config holds every setting of the bot for one workspace. It is loaded from a JSON file at startup,
+// see example/config.json for a starting point. Any field left out of the file
+// keeps the value from DefaultConfig.
+type Config struct {
+	// The name of the workspace, used in the output and for its data directory.
+	// Only needed when the config file has several workspaces.
+	Name string `json:"name"`
+	// Where the emoji snapshots, images and state are saved. Defaults to ~/Documents/emojiSnapshots,
+	// or to a directory named after the workspace in there when the config file has several workspaces.
+	DataDir string `json:"data_dir"`
+
+	// The Slack user name of the person who should be contacted in case of problems.
+	// This should not include the @ symbol.
+	OwnerLDAP string `json:"owner_ldap"`
+	// Should look like U0XXXXXXXX
+	OwnerUserId string `json:"owner_user_id"`
+	// Other people who get the review DMs in dm_for_review mode.
+	AdditionalReviewerIds []string `json:"additional_reviewer_ids"`
+
+	// The bot token, starts with xoxb-
+	BotOauthToken string `json:"bot_oauth_token"`
+	// Where the list of emojis comes from. admin_list is the undocumented endpoint that the Slack website
+	// uses, which has upload times and uploaders. emoji_list is the official API which only needs the bot
+	// token, but does not say who uploaded an emoji, so the uploader rankings are skipped.
+	EmojiSource string `json:"emoji_source"`
+	// The workspace for admin_list, like "myteam" for myteam.slack.com.
+	WorkspaceDomain string `json:"workspace_domain"`
+	// For an app installed on an Enterprise Grid org, the ID of the workspace that
+	// emoji_channel is in, like T0XXXXXXXX.
+	TeamId string `json:"team_id"`
+	// The user token and cookie of the owner, used for admin_list.
+	OwnerUserOauthToken string `json:"owner_user_oauth_token"`
+	OwnerUserCookie     string `json:"owner_user_cookie"`
+
+	// People really dislike pictures of some frog.
+	// Sometimes you have to keep the peace...
+	// Can be specified with or without the colons.
+	SkipEmojis util.StringSet `json:"skip_emojis"`
+	// Some people prefer not to be pinged to join the channel.
+	MuteLDAPs util.StringSet `json:"mute_ldaps"`
+	// Some people may not want to be a part of this at all.
+	SkipLDAPs util.StringSet `json:"skip_ldaps"`
+
+	// Used by the meme counter when there are no new meme emojis. Do not include the colons.
+	GenericSadEmoji string      `json:"generic_sad_emoji"`
+	EmojiMemes      []EmojiMeme `json:"emoji_memes"`
+
+	// Caching all emoji images can take a lot of time and storage, so you
+	// may want to leave it off. It takes 547MB for my company's Slack.
+	// The only use of cashing all images is to see what deleted emojis were.
+	// After all emojis have been downloaded the first time, this will only download new and re-uploaded emojis.
+	// You can also download the image for a deleted emoji if it has not been deleted for very long.
+	CacheImages bool `json:"cache_images"`
+	// How many images cache_images downloads at the same time.
+	ImageDownloadWorkers int `json:"image_download_workers"`
+	// List the new emojis that have the same image as an older emoji in the review DM, going by the images
+	// from cache_images. Resized and compressed copies are found too.
+	DetectDuplicateImages bool `json:"detect_duplicate_images"`
+	// Leave the copies found by detect_duplicate_images out of the new emoji post.
+	SkipDuplicateImages bool `json:"skip_duplicate_images"`
+	// How different two images can be, out of 64, to count as copies. 0 only finds images that are
+	// almost the same, and more than 10 finds images that only look alike.
+	DuplicateImageDistance int `json:"duplicate_image_distance"`
+	// This controls if the JSON blob of all current emojis is cached. This is only used for detecting
+	// deleted emojis.
+	CacheEmojiDumps bool `json:"cache_emoji_dumps"`
+
+	// Top uploaders of all time is noisy.
+	// I only send at the end of the year, if someone has recently moved up a lot, etc.
+	SendTopUploadersAllTime  bool `json:"send_top_uploaders_all_time"`
+	FindLongestEmojisAllTime bool `json:"find_longest_emojis_all_time"`
+
+	SkipTopEmojisByReactionVote bool `json:"skip_top_emojis_by_reaction_vote"`
+	// Votes for an alias always count for the emoji it is for. This also says which aliases were voted
+	// with, and who made them, next to the emoji in the top emojis.
+	NoteAliasCreators bool `json:"note_alias_creators"`
+
+	// Vote rules for the top emojis. An emoji needs min_votes votes to be one of the top emojis.
+	MinVotes int `json:"min_votes"`
+	// Only count the votes for the new emojis that were up for the vote, and not for any other emoji.
+	OnlyVotesForNewEmojis bool `json:"only_votes_for_new_emojis"`
+	// Do not count the votes of uploaders for their own emojis.
+	IgnoreSelfVotes bool `json:"ignore_self_votes"`
+	// How many emojis each person can vote for on a vote prompt, or 0 for no limit. The votes after the
+	// limit, in the order of the reactions on the prompt, do not count.
+	MaxVotesPerVoter int `json:"max_votes_per_voter"`
+	// Do not count the reactions that the bot added to its own vote prompt.
+	IgnoreBotVotes bool `json:"ignore_bot_votes"`
+	// Split the vote of each person between the emojis they voted for, so that voting for more emojis
+	// does not give more votes.
+	EqualVoterWeight bool `json:"equal_voter_weight"`
+	// How the votes are counted. approval counts every vote, plurality only counts the first emoji that
+	// each person voted for, and ranked_choice is an instant runoff on the order that each person voted in.
+	// Slack does not say that order, so serve saves it from the reaction events when app_token is set.
+	// Reactions that serve did not see are ranked after the others, in the order they are on the prompt.
+	VoteTally string `json:"vote_tally"`
+
+	// If this is turned on, emojis in the format "emoji-name-123" will be skipped.
+	// This is the format used by Slack if another work space's emojis are merged in and there are duplicate names.
+	SkipDuplicateBulkImportEmojis bool `json:"skip_duplicate_bulk_import_emojis"`
+	// Do not include emojis if after removing - and _ they are a dupe of an existing emoji.
+	StrictUniqueMode bool `json:"strict_unique_mode"`
+	// Skip emojis that begin with screen-shot-, the format that Mac uses by default.
+	SkipScreenShots bool `json:"skip_screen_shots"`
+	// Disables the emojis to skip list.
+	Literally1984Mode bool `json:"literally_1984_mode"`
+
+	// Replaces all emoijs sent with a single emoji, ideally an old school windows broken image emoji.
+	AprilFoolsMode bool `json:"april_fools_mode"`
+	// Do not include the colons
+	AprilFoolsEmoji string `json:"april_fools_emoji"`
+
+	// Needs to be used after turning off April Fools mode
+	// to prevent the joke emoji from being detected as the last mew emoji.
+	// Can also be used when running the script for the first time.
+	// Can have colons or not, doesn't matter.
+	OverRideLastNewEmoji string `json:"override_last_new_emoji"`
+
+	// The channel to post these messages in when in FULL_SEND mode.
+	EmojiChannel string `json:"emoji_channel"`
+	// The ID of EmojiChannel. Setting this skips looking up the channel by name.
+	CachedChannelID string `json:"cached_channel_id"`
+
+	// This controls if things are printed, DMed or posted publicly.
+	// One of print_everything, dm_for_review, dm_for_testing or full_send.
+	RunMode Mode `json:"run_mode"`
+	// In dm_for_review, DM the whole preview with Approve, Edit skip list and Reject buttons. Approving
+	// it posts the preview to emoji_channel as it is. The buttons need serve to be running with app_token.
+	InteractiveReview bool `json:"interactive_review"`
+	// Send messages as plain text instead of Block Kit layouts with headers and sections.
+	PlainTextMessages bool `json:"plain_text_messages"`
+	// Other places for the reports to go besides Slack, like a wiki page or a dashboard, by name.
+	Sinks map[string]*SinkConfig `json:"sinks"`
+	// Which sinks get each type of message. The keys are send, send_and_review, review_only, dm_only and
+	// print_only. Besides the sinks above, "slack" posts, DMs or prints like run_mode says, and "stdout"
+	// prints. Types that are left out go to "slack", and types with an empty list go nowhere.
+	Routes map[string][]string `json:"routes"`
+
+	// When doing Emojis Wrapped, fast mode is ignored
+	DoEmojisWrapped      bool `json:"do_emojis_wrapped"`
+	DoHeBringsYouCounter bool `json:"do_he_brings_you_counter"`
+	// FastMode will not fetch all emojis, just the ones since the last emoji post.
+	// Detecting deleted emojis is not possible in fast mode.
+	FastMode bool `json:"fast_mode"`
+
+	// These settings are only used by the serve command.
+	// When to run the weekly pipeline, as a cron expression: minute hour day-of-month month day-of-week.
+	Schedule string `json:"schedule"`
+	// When to run Emojis Wrapped for the previous year. Leave empty to never run it automatically.
+	WrappedSchedule string `json:"wrapped_schedule"`
+	// The time zone of the schedules, like America/Los_Angeles. Defaults to the local time zone.
+	TimeZone string `json:"time_zone"`
+	// If set, the address to serve the next scheduled run times on, like :8080.
+	StatusAddress string `json:"status_address"`
+	// The app-level token, starts with xapp-. If set, the serve command listens for
+	// emoji_changed events over Socket Mode and saves them to the local history.
+	AppToken string `json:"app_token"`
+	// Post a message to emoji_channel as soon as a new emoji is uploaded. Needs app_token.
+	AnnounceNewEmojis bool `json:"announce_new_emojis"`
+}
+
+// DefaultConfig is the config before the config file is applied.
+func DefaultConfig() *Config {
+	return &Config{
+		EmojiSource:            EMOJI_SOURCE__ADMIN_LIST,
+		SkipEmojis:             util.StringSet{},
+		MuteLDAPs:              util.StringSet{},
+		SkipLDAPs:              util.StringSet{},
+		CacheEmojiDumps:        true,
+		ImageDownloadWorkers:   8,
+		DuplicateImageDistance: 4,
+		MinVotes:               minReactions,
+		IgnoreBotVotes:         true,
+		VoteTally:              VOTE_TALLY__APPROVAL,
+		SkipScreenShots:        true,
+		Literally1984Mode:      true,
+		AprilFoolsEmoji:        "broken-img",
+		EmojiChannel:           "#emojis",
+		RunMode:                MODE__DM_FOR_REVIEW,
+		DoHeBringsYouCounter:   true,
+		FastMode:               true,
+		Schedule:               "0 10 * * 1",
+		WrappedSchedule:        "0 10 2 1 *",
+	}
+}
+
+// configFile is the layout of the config file. It is either the settings of one workspace, or the
+// settings that the workspaces share and a list of workspaces, each with the settings that are its own.
+type configFile struct {
+	Config
+	Workspaces []json.RawMessage `json:"workspaces"`
+}
+
+func parseConfigFile(contents []byte) (*configFile, error) {
+	file := &configFile{Config: *DefaultConfig()}
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// LoadConfig reads, checks and normalizes a config file that has a single workspace.
+func LoadConfig(fileName string) (*Config, error) {
+	configs, err := LoadWorkspaces(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) != 1 {
+		return nil, fmt.Errorf("config file %v has %d workspaces, expected one", fileName, len(configs))
+	}
+	return configs[0], nil
+}
+
+// LoadWorkspaces reads, checks and normalizes the config file, and returns the config of every workspace in it.
+func LoadWorkspaces(fileName string) ([]*Config, error) {
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	file, err := parseConfigFile(contents)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file %v: %w", fileName, err)
+	}
+	if len(file.Workspaces) == 0 {
+		conf := &file.Config
+		err = conf.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid config file %v: %w", fileName, err)
+		}
+		conf.normalize()
+		return []*Config{conf}, nil
+	}
+
+	var configs []*Config
+	dataDirs := map[string]string{}
+	statusAddresses := map[string]string{}
+	for i, workspace := range file.Workspaces {
+		// The shared settings are parsed again for every workspace, so that the workspaces do not share their lists.
+		shared, err := parseConfigFile(contents)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse config file %v: %w", fileName, err)
+		}
+		conf := &shared.Config
+		decoder := json.NewDecoder(bytes.NewReader(workspace))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(conf)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse workspace %d in config file %v: %w", i+1, fileName, err)
+		}
+		if conf.Name == "" || conf.Name != filepath.Base(conf.Name) || strings.HasPrefix(conf.Name, ".") {
+			return nil, fmt.Errorf("workspace %d in config file %v needs a name that can be a directory name", i+1, fileName)
+		}
+		var keys map[string]json.RawMessage
+		err = json.Unmarshal(workspace, &keys)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse workspace %d in config file %v: %w", i+1, fileName, err)
+		}
+		if _, ok := keys["data_dir"]; !ok {
+			// Each workspace that does not set data_dir gets its own directory in the shared one.
+			dataDir, err := conf.dataDir()
+			if err != nil {
+				return nil, err
+			}
+			conf.DataDir = filepath.Join(dataDir, conf.Name)
+		}
+		err = conf.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid workspace %v in config file %v: %w", conf.Name, fileName, err)
+		}
+		conf.normalize()
+		if other, ok := dataDirs[conf.DataDir]; ok {
+			return nil, fmt.Errorf("workspaces %v and %v in config file %v have the same data_dir", other, conf.Name, fileName)
+		}
+		dataDirs[conf.DataDir] = conf.Name
+		if other, ok := statusAddresses[conf.StatusAddress]; ok && conf.StatusAddress != "" {
+			return nil, fmt.Errorf("workspaces %v and %v in config file %v have the same status_address", other, conf.Name, fileName)
+		}
+		statusAddresses[conf.StatusAddress] = conf.Name
+		configs = append(configs, conf)
+	}
+	return configs, nil
+}
+
+func (c *Config) validate() error {
+	if c.OwnerLDAP == "" {
+		return errors.New("owner_ldap is required")
+	}
+	if c.OwnerUserId == "" {
+		return errors.New("owner_user_id is required")
+	}
+	if c.BotOauthToken == "" {
+		return errors.New("bot_oauth_token is required")
+	}
+	switch c.EmojiSource {
+	case EMOJI_SOURCE__ADMIN_LIST:
+		if c.WorkspaceDomain == "" {
+			return errors.New("workspace_domain is required for the admin_list emoji source")
+		}
+		if c.OwnerUserOauthToken == "" {
+			return errors.New("owner_user_oauth_token is required for the admin_list emoji source")
+		}
+	case EMOJI_SOURCE__EMOJI_LIST:
+	default:
+		return fmt.Errorf("unknown emoji_source %q, expected admin_list or emoji_list", c.EmojiSource)
+	}
+	if c.EmojiChannel == "" {
+		return errors.New("emoji_channel is required")
+	}
+	if c.AprilFoolsMode && c.AprilFoolsEmoji == "" {
+		return errors.New("april_fools_emoji is required when april_fools_mode is on")
+	}
+	if c.DoHeBringsYouCounter && len(c.EmojiMemes) > 0 && c.GenericSadEmoji == "" {
+		return errors.New("generic_sad_emoji is required when emoji_memes are set")
+	}
+	if c.AnnounceNewEmojis && c.AppToken == "" {
+		return errors.New("app_token is required when announce_new_emojis is on")
+	}
+	if c.InteractiveReview && c.AppToken == "" {
+		return errors.New("app_token is required when interactive_review is on")
+	}
+	if c.CacheImages && c.ImageDownloadWorkers < 1 {
+		return errors.New("image_download_workers must be at least 1 when cache_images is on")
+	}
+	if c.DetectDuplicateImages && !c.CacheImages {
+		return errors.New("cache_images is required when detect_duplicate_images is on")
+	}
+	if c.SkipDuplicateImages && !c.DetectDuplicateImages {
+		return errors.New("detect_duplicate_images is required when skip_duplicate_images is on")
+	}
+	if c.DuplicateImageDistance < 0 || c.DuplicateImageDistance > 64 {
+		return errors.New("duplicate_image_distance must be between 0 and 64")
+	}
+	if c.MinVotes < 0 {
+		return errors.New("min_votes can not be negative")
+	}
+	if c.MaxVotesPerVoter < 0 {
+		return errors.New("max_votes_per_voter can not be negative")
+	}
+	switch c.VoteTally {
+	case "", VOTE_TALLY__APPROVAL:
+	case VOTE_TALLY__PLURALITY, VOTE_TALLY__RANKED_CHOICE:
+		if c.EqualVoterWeight {
+			return fmt.Errorf("equal_voter_weight only works with the approval vote_tally, not %v", c.VoteTally)
+		}
+	default:
+		return fmt.Errorf("unknown vote_tally %q, expected approval, plurality or ranked_choice", c.VoteTally)
+	}
+	location, err := c.Location()
+	if err != nil {
+		return fmt.Errorf("invalid time_zone: %w", err)
+	}
+	_, err = parseCronSchedule(c.Schedule, location)
+	if err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	if c.WrappedSchedule != "" {
+		_, err = parseCronSchedule(c.WrappedSchedule, location)
+		if err != nil {
+			return fmt.Errorf("invalid wrapped_schedule: %w", err)
+		}
+	}
+	for _, meme := range c.EmojiMemes {
+		if meme.EmojiName == "" || len(meme.SubStrings) == 0 {
+			return errors.New("every emoji meme needs an emoji_name and sub_strings")
+		}
+	}
+	for name, sink := range c.Sinks {
+		err = sink.validate(name)
+		if err != nil {
+			return err
+		}
+	}
+	for typeName := range c.Routes {
+		_, err = ParseMessageType(typeName)
+		if err != nil {
+			return fmt.Errorf("invalid routes: %w", err)
+		}
+	}
+	return nil
+}
+
+// dataDir is where the snapshots, images and state of the workspace go.
+func (c *Config) dataDir() (string, error) {
+	if c.DataDir != "" {
+		return c.DataDir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return homeDir + defaultDataDir, nil
+}
+
+// Location is the time zone from time_zone, or the local time zone if it is not set.
+func (c *Config) Location() (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.TimeZone)
+}
+
+func (c *Config) normalize() {
+	// Remove colons. This allows the emojis to be specified as
+	// :emoji_name: or just emoji_name
+	for emoji := range c.SkipEmojis {
+		if strings.Contains(emoji, ":") {
+			c.SkipEmojis[strings.ReplaceAll(emoji, ":", "")] = util.SetEntry{}
+			delete(c.SkipEmojis, emoji)
+		}
+	}
+	c.WorkspaceDomain = strings.TrimSuffix(strings.TrimPrefix(c.WorkspaceDomain, "https://"), ".slack.com")
+	c.AprilFoolsEmoji = strings.ReplaceAll(c.AprilFoolsEmoji, ":", "")
+	c.GenericSadEmoji = strings.ReplaceAll(c.GenericSadEmoji, ":", "")
+	c.OverRideLastNewEmoji = strings.ReplaceAll(c.OverRideLastNewEmoji, ":", "")
+}
+
+type Mode int
+
+const (
+	MODE__PRINT_EVERYTHING Mode = iota
+	MODE__DM_FOR_REVIEW
+	MODE__DM_FOR_TESTING
+	MODE__FULL_SEND
+)
+
+var modeNames = map[Mode]string{
+	MODE__PRINT_EVERYTHING: "print_everything",
+	MODE__DM_FOR_REVIEW:    "dm_for_review",
+	MODE__DM_FOR_TESTING:   "dm_for_testing",
+	MODE__FULL_SEND:        "full_send",
+}
+
+func (m Mode) String() string {
+	if name, ok := modeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+func ParseMode(name string) (Mode, error) {
+	for mode, modeName := range modeNames {
+		if modeName == name {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown run mode %q, expected one of print_everything, dm_for_review, dm_for_testing or full_send", name)
+}
+
+func (m Mode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+func (m *Mode) UnmarshalJSON(data []byte) error {
+	var name string
+	err := json.Unmarshal(data, &name)
+	if err != nil {
+		return err
+	}
+	*m, err = ParseMode(name)
+	return err
+}
@@ -0,0 +1,133 @@
+package bot
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	fileName := filepath.Join(t.TempDir(), "config.json")
+	err := ioutil.WriteFile(fileName, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestLoadWorkspaces(t *testing.T) {
+	dataDir := t.TempDir()
+	fileName := writeConfigFile(t, `{
+		"owner_ldap": "owner",
+		"owner_user_id": "UOWNER",
+		"emoji_source": "emoji_list",
+		"data_dir": "`+dataDir+`",
+		"skip_emojis": [":frog:"],
+		"workspaces": [
+			{"name": "eng", "bot_oauth_token": "xoxb-eng", "emoji_channel": "#eng-emojis"},
+			{"name": "sales", "bot_oauth_token": "xoxb-sales", "skip_emojis": ["cat"], "team_id": "T0SALES"}
+		]
+	}`)
+
+	configs, err := LoadWorkspaces(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("got %d workspaces, want 2", len(configs))
+	}
+	eng, sales := configs[0], configs[1]
+	if eng.BotOauthToken != "xoxb-eng" || sales.BotOauthToken != "xoxb-sales" {
+		t.Errorf("the workspaces did not get their own tokens: %v, %v", eng.BotOauthToken, sales.BotOauthToken)
+	}
+	if eng.EmojiChannel != "#eng-emojis" || sales.EmojiChannel != "#emojis" {
+		t.Errorf("unexpected channels %v, %v", eng.EmojiChannel, sales.EmojiChannel)
+	}
+	if eng.OwnerLDAP != "owner" || sales.OwnerLDAP != "owner" {
+		t.Error("the workspaces did not get the shared settings")
+	}
+	if _, ok := eng.SkipEmojis["frog"]; !ok || len(eng.SkipEmojis) != 1 {
+		t.Errorf("eng should skip the shared emojis, got %v", eng.SkipEmojis)
+	}
+	if _, ok := sales.SkipEmojis["cat"]; !ok || len(sales.SkipEmojis) != 1 {
+		t.Errorf("sales should replace the shared skip list, got %v", sales.SkipEmojis)
+	}
+	if eng.DataDir != filepath.Join(dataDir, "eng") || sales.DataDir != filepath.Join(dataDir, "sales") {
+		t.Errorf("the workspaces should have their own data directories, got %v and %v", eng.DataDir, sales.DataDir)
+	}
+	if sales.TeamId != "T0SALES" {
+		t.Errorf("unexpected team ID %v", sales.TeamId)
+	}
+}
+
+func TestLoadWorkspacesKeepsASetDataDir(t *testing.T) {
+	dataDir := t.TempDir()
+	fileName := writeConfigFile(t, `{
+		"owner_ldap": "owner",
+		"owner_user_id": "UOWNER",
+		"emoji_source": "emoji_list",
+		"data_dir": "`+dataDir+`",
+		"workspaces": [
+			{"name": "eng", "bot_oauth_token": "xoxb-eng", "data_dir": "`+dataDir+`"},
+			{"name": "sales", "bot_oauth_token": "xoxb-sales"}
+		]
+	}`)
+
+	configs, err := LoadWorkspaces(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// eng set data_dir itself, even though it is the same as the shared one.
+	if configs[0].DataDir != dataDir || configs[1].DataDir != filepath.Join(dataDir, "sales") {
+		t.Errorf("unexpected data directories %v and %v", configs[0].DataDir, configs[1].DataDir)
+	}
+}
+
+func TestLoadWorkspacesErrors(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		workspaces string
+		wantError  string
+	}{
+		{
+			name:       "missing name",
+			workspaces: `[{"bot_oauth_token": "xoxb-1"}]`,
+			wantError:  "needs a name",
+		},
+		{
+			name:       "name is a path",
+			workspaces: `[{"name": "../eng", "bot_oauth_token": "xoxb-1"}]`,
+			wantError:  "needs a name",
+		},
+		{
+			name:       "same data directory",
+			workspaces: `[{"name": "eng", "bot_oauth_token": "xoxb-1"}, {"name": "eng", "bot_oauth_token": "xoxb-2"}]`,
+			wantError:  "have the same data_dir",
+		},
+		{
+			name:       "same status address",
+			workspaces: `[{"name": "eng", "bot_oauth_token": "xoxb-1", "status_address": ":8080"}, {"name": "sales", "bot_oauth_token": "xoxb-2", "status_address": ":8080"}]`,
+			wantError:  "have the same status_address",
+		},
+		{
+			name:       "invalid workspace",
+			workspaces: `[{"name": "eng"}]`,
+			wantError:  "invalid workspace eng",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fileName := writeConfigFile(t, `{
+				"owner_ldap": "owner",
+				"owner_user_id": "UOWNER",
+				"emoji_source": "emoji_list",
+				"data_dir": "`+t.TempDir()+`",
+				"workspaces": `+test.workspaces+`
+			}`)
+			_, err := LoadWorkspaces(fileName)
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("got error %v, want one containing %q", err, test.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var cutoffDateFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseCutoff parses a point in time relative to now. It accepts dates like 2025-01-31,
+// date times like 2025-01-31T09:00 or RFC 3339, and ages like 7d, 2w, 36h or "7 days ago".
+// Dates without a time zone are in location.
+func ParseCutoff(value string, now time.Time, location *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, format := range cutoffDateFormats {
+		cutoff, err := time.ParseInLocation(format, value, location)
+		if err == nil {
+			return cutoff, nil
+		}
+	}
+	age, err := parseAge(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse %q as a date or an age like 7d: %w", value, err)
+	}
+	return now.Add(-age), nil
+}
+
+func parseAge(value string) (time.Duration, error) {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.ToLower(value), "ago"))
+	units := []struct {
+		suffixes []string
+		duration time.Duration
+	}{
+		{suffixes: []string{"weeks", "week", "w"}, duration: 7 * 24 * time.Hour},
+		{suffixes: []string{"days", "day", "d"}, duration: 24 * time.Hour},
+	}
+	for _, unit := range units {
+		for _, suffix := range unit.suffixes {
+			if strings.HasSuffix(value, suffix) {
+				count, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(value, suffix)))
+				if err != nil {
+					return 0, err
+				}
+				return time.Duration(count) * unit.duration, nil
+			}
+		}
+	}
+	return time.ParseDuration(strings.ReplaceAll(value, " ", ""))
+}
@@ -0,0 +1,204 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"os"
+	"sort"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// perceptualHash is the difference hash of an image, as 16 hex digits. Each bit says whether a cell of a 9 by 8
+// grayscale thumbnail is brighter than the cell to its right. Resizing or compressing an image again barely
+// changes it, unlike the sha256 of the file. Returns an empty string for images that can not be decoded,
+// and for images without any detail, like a single color, which would look like each other.
+func perceptualHash(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return ""
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() < 9 || bounds.Dy() < 8 {
+		return ""
+	}
+	// The average brightness of each cell, with transparent pixels on white like Slack shows them.
+	var cells [8][9]float64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 9; x++ {
+			x0, x1 := bounds.Min.X+x*bounds.Dx()/9, bounds.Min.X+(x+1)*bounds.Dx()/9
+			y0, y1 := bounds.Min.Y+y*bounds.Dy()/8, bounds.Min.Y+(y+1)*bounds.Dy()/8
+			var sum float64
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					r, g, b, a := img.At(px, py).RGBA()
+					white := float64(0xffff - a)
+					sum += 0.299*(float64(r)+white) + 0.587*(float64(g)+white) + 0.114*(float64(b)+white)
+				}
+			}
+			cells[y][x] = sum / float64((x1-x0)*(y1-y0))
+		}
+	}
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if cells[y][x] < cells[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	if hash == 0 || hash == ^uint64(0) {
+		return ""
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+// hashDistance is how many bits of two perceptual hashes differ, or -1 if either is missing.
+func hashDistance(a, b string) int {
+	if a == "" || b == "" {
+		return -1
+	}
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return -1
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return -1
+	}
+	return bits.OnesCount64(x ^ y)
+}
+
+// emojiImage is an emoji and its image in the image cache.
+type emojiImage struct {
+	record *emojiRecord
+	image  *cachedImage
+}
+
+// currentEmojiImages returns the cached images of the emojis that still exist, by emoji name. Aliases share
+// the image of their emoji, so they are left out.
+func (b *Bot) currentEmojiImages() (map[string]*emojiImage, error) {
+	images := map[string]*emojiImage{}
+	err := b.withHistory(false, func(tx *bolt.Tx) error {
+		return forEachEmojiRecord(tx, func(record *emojiRecord) error {
+			if !record.Removed.IsZero() || record.AliasFor != "" || record.Url == "" {
+				return nil
+			}
+			value := tx.Bucket(historyImagesBucket).Get([]byte(imageUrlKey(record.Url)))
+			if value == nil {
+				return nil
+			}
+			cached := &cachedImage{}
+			err := json.Unmarshal(value, cached)
+			if err != nil {
+				return fmt.Errorf("unable to read the image of %v from the history: %w", record.Name, err)
+			}
+			images[record.Name] = &emojiImage{record: record, image: cached}
+			return nil
+		})
+	})
+	return images, err
+}
+
+// duplicateImage is a new emoji with the same image as an older emoji.
+type duplicateImage struct {
+	Emoji    *Emoji
+	Original string
+	// Set if the files are the same, and not only similar.
+	Exact bool
+}
+
+// findDuplicateImages looks for the new emojis that have the same image as an emoji that was uploaded before
+// them, going by the sha256 of the files, or perceptual hashes that are at most duplicate_image_distance apart.
+func (b *Bot) findDuplicateImages(response *SlackEmojiResponseMessage) ([]*duplicateImage, error) {
+	newEmojiList, _ := b.newEmojis(response)
+	if len(newEmojiList) == 0 {
+		return nil, nil
+	}
+	images, err := b.currentEmojiImages()
+	if err != nil {
+		return nil, err
+	}
+	var duplicates []*duplicateImage
+	// Oldest first, so that the first of two new copies is the original.
+	for i := len(newEmojiList) - 1; i >= 0; i-- {
+		emoji := newEmojiList[i]
+		current, ok := images[emoji.Name]
+		if !ok {
+			continue
+		}
+		var best *duplicateImage
+		var bestDistance int
+		var bestCreated int64
+		for name, other := range images {
+			if name == emoji.Name || other.record.Created > int64(emoji.Created) ||
+				(other.record.Created == int64(emoji.Created) && name > emoji.Name) {
+				continue
+			}
+			// Exact copies come before similar images, and then the oldest emoji is the original.
+			distance := -1
+			if current.image.Hash != other.image.Hash {
+				distance = hashDistance(current.image.PerceptualHash, other.image.PerceptualHash)
+				if distance < 0 || distance > b.config.DuplicateImageDistance {
+					continue
+				}
+			}
+			if best == nil || distance < bestDistance || (distance == bestDistance && (other.record.Created < bestCreated ||
+				(other.record.Created == bestCreated && name < best.Original))) {
+				best = &duplicateImage{Emoji: emoji, Original: name, Exact: distance < 0}
+				bestDistance = distance
+				bestCreated = other.record.Created
+			}
+		}
+		if best != nil {
+			duplicates = append(duplicates, best)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i].Emoji.Name < duplicates[j].Emoji.Name })
+	return duplicates, nil
+}
+
+// duplicateImages tells the reviewers about new emojis that are copies of an older emoji, and with
+// skip_duplicate_images, leaves them out of the response. The run still ends after the newest of them, so
+// that they are not reported again next week.
+func (b *Bot) duplicateImages(response *SlackEmojiResponseMessage) error {
+	duplicates, err := b.findDuplicateImages(response)
+	if err != nil || len(duplicates) == 0 {
+		return err
+	}
+	_, err = b.printMessages(MSG_TYPE__REVIEW_ONLY, renderDuplicateImages(duplicates, b.config.SkipDuplicateImages), "")
+	if err != nil {
+		return err
+	}
+	if !b.config.SkipDuplicateImages {
+		return nil
+	}
+	skipped := map[string]bool{}
+	for _, duplicate := range duplicates {
+		skipped[duplicate.Emoji.Name] = true
+		delete(response.emojiMap, duplicate.Emoji.Name)
+		if b.newestSkippedEmoji == nil || duplicate.Emoji.Created > b.newestSkippedEmoji.Created {
+			b.newestSkippedEmoji = duplicate.Emoji
+		}
+	}
+	var kept []*Emoji
+	for _, emoji := range response.Emoji {
+		if !skipped[emoji.Name] {
+			kept = append(kept, emoji)
+		}
+	}
+	response.Emoji = kept
+	return nil
+}
@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryho/slack-emoji-bot/fakeslack"
+)
+
+// patternPng draws a smooth pattern, which looks the same at any size.
+func patternPng(t *testing.T, size int, fx, fy float64) []byte {
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			u, v := float64(x)/float64(size), float64(y)/float64(size)
+			img.SetGray(x, y, color.Gray{Y: uint8(128 + 100*math.Sin(u*fx)*math.Cos(v*fy))})
+		}
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPerceptualHashFindsResizedCopies(t *testing.T) {
+	dir := t.TempDir()
+	hashes := map[string]string{}
+	for name, contents := range map[string][]byte{
+		"small":     patternPng(t, 64, 7, 5),
+		"big":       patternPng(t, 128, 7, 5),
+		"different": patternPng(t, 64, 3, 11),
+	} {
+		path := filepath.Join(dir, name+".png")
+		err := writeFileAtomic(path, contents)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[name] = perceptualHash(path)
+	}
+	if distance := hashDistance(hashes["small"], hashes["big"]); distance < 0 || distance > 4 {
+		t.Errorf("a resized copy is %v apart", distance)
+	}
+	if distance := hashDistance(hashes["small"], hashes["different"]); distance <= 10 {
+		t.Errorf("different images are only %v apart", distance)
+	}
+	if hash := perceptualHash(filepath.Join(dir, "missing.png")); hash != "" {
+		t.Errorf("got %v for a missing image", hash)
+	}
+}
+
+func TestWeeklyReportsDuplicateImages(t *testing.T) {
+	b, server := setupWeekly(t)
+	b.config.RunMode = MODE__DM_FOR_REVIEW
+	b.config.CacheImages = true
+	b.config.DetectDuplicateImages = true
+	b.config.SkipDuplicateImages = true
+	images := map[string][]byte{
+		"/original.png": patternPng(t, 64, 7, 5),
+		"/copy.png":     patternPng(t, 64, 7, 5),
+		"/resized.png":  patternPng(t, 128, 7, 5),
+		"/other.png":    patternPng(t, 64, 3, 11),
+	}
+	imageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contents, ok := images[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(contents)
+	}))
+	t.Cleanup(imageServer.Close)
+	// The newest emoji is a copy.
+	for i, name := range []string{"original", "other", "copy", "resized"} {
+		server.AddEmoji(fakeslack.Emoji{
+			Name:    name,
+			Url:     imageServer.URL + "/" + name + ".png",
+			Created: int(time.Now().Add(time.Duration(i-5) * time.Hour).Unix()),
+			UserId:  "U1",
+		})
+	}
+
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	posted := postedTo(server, "UOWNER")
+	report := findPosted(t, posted, "Possible duplicate emojis")
+	for _, want := range []string{
+		":copy: copy is the same image as :original: original",
+		":resized: resized looks like :original: original",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("%q is not in %q", want, report)
+		}
+	}
+	if strings.Contains(report, ":other:") {
+		t.Errorf("a different image was reported as a copy: %q", report)
+	}
+	grid := findPosted(t, posted, "Here are all the new emojis")
+	if strings.Contains(grid, ":copy:") || strings.Contains(grid, ":resized:") || !strings.Contains(grid, ":original:") {
+		t.Errorf("expected the copies to be left out of %q", grid)
+	}
+
+	// The next run starts after the copies, so they are not reported again.
+	if b.thisRun.LastNewEmoji != "resized" {
+		t.Errorf("expected the run to end at the newest copy, got %+v", b.thisRun)
+	}
+	// Review mode does not save the run, so save it like a run that posted to the channel.
+	err = b.recordRun(b.thisRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addEmoji(server, "new-one", "U2", time.Hour)
+	reported := len(server.Posted())
+	b.resetRunState()
+	err = b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range postedTo(server, "UOWNER")[len(posted):] {
+		if strings.Contains(text, "Possible duplicate emojis") {
+			t.Errorf("the copies were reported again: %q", text)
+		}
+	}
+	if len(server.Posted()) == reported {
+		t.Error("the second run posted nothing")
+	}
+	findPosted(t, postedTo(server, "UOWNER")[len(posted):], ":new-one:")
+}
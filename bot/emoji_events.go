@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack/slackevents"
+)
+
+const (
+	eventsDir       = "events/"
+	emojiEventsFile = "emojiEvents.jsonl"
+
+	liveNewEmojiMessage = ":new-shine: New emoji :%s: %s"
+)
+
+// emojiEvent is an emoji_changed event as it is saved in the local history.
+type emojiEvent struct {
+	Time time.Time `json:"time"`
+	// One of add, remove or rename.
+	Subtype string `json:"subtype"`
+	// Filled out when an emoji is added.
+	Name string `json:"name,omitempty"`
+	// Filled out when emojis are removed.
+	Names []string `json:"names,omitempty"`
+	// Filled out when an emoji is renamed.
+	OldName string `json:"old_name,omitempty"`
+	NewName string `json:"new_name,omitempty"`
+	// The image URL, or alias:name for aliases.
+	Value string `json:"value,omitempty"`
+}
+
+func (b *Bot) handleEmojiChanged(event *slackevents.EmojiChangedEvent) error {
+	record := &emojiEvent{
+		Time:    eventTime(event.EventTimeStamp, b.now()),
+		Subtype: event.Subtype,
+		Name:    event.Name,
+		Names:   event.Names,
+		OldName: event.OldName,
+		NewName: event.NewName,
+		Value:   event.Value,
+	}
+	err := b.recordEmojiEvent(record)
+	if err != nil {
+		return err
+	}
+	err = b.recordEmojiEventInHistory(record)
+	if err != nil {
+		return err
+	}
+	if event.Subtype == "add" && b.config.AnnounceNewEmojis && !strings.HasPrefix(event.Value, "alias:") {
+		return b.announceNewEmoji(event.Name)
+	}
+	return nil
+}
+
+func (b *Bot) announceNewEmoji(name string) error {
+	if b.config.Literally1984Mode {
+		if _, ok := b.config.SkipEmojis[name]; ok {
+			return nil
+		}
+	}
+	if b.config.SkipScreenShots && strings.HasPrefix(name, "screen-shot-") {
+		return nil
+	}
+	emojiName := name
+	if b.config.AprilFoolsMode {
+		emojiName = b.config.AprilFoolsEmoji
+	}
+	message := plainMessage(fmt.Sprintf(liveNewEmojiMessage, emojiName, name))
+	if b.config.RunMode == MODE__PRINT_EVERYTHING {
+		b.print(message)
+		return nil
+	}
+	// Announcements are not reports, so they only go to Slack. They are not part of a run either, so they
+	// skip the journal and the transcript.
+	_, err := b.sendByRunMode(MSG_TYPE__SEND, message, "", b.postOutsideRun)
+	return err
+}
+
+// eventTime is the time of an event, or now if the event does not say.
+func eventTime(timestamp json.Number, now time.Time) time.Time {
+	seconds, err := strconv.ParseFloat(string(timestamp), 64)
+	if err != nil || seconds == 0 {
+		return now
+	}
+	return time.Unix(0, int64(float64(time.Second)*seconds))
+}
+
+func (b *Bot) emojiEventsPath() string {
+	return b.dataDir + eventsDir + emojiEventsFile
+}
+
+func (b *Bot) recordEmojiEvent(event *emojiEvent) error {
+	b.emojiEventsLock.Lock()
+	defer b.emojiEventsLock.Unlock()
+	err := ensureDirExists(b.dataDir + eventsDir)
+	if err != nil {
+		return err
+	}
+	fileName := b.emojiEventsPath()
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(eventBytes, '\n'))
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readEmojiEvents reads the saved emoji events that happened after the given time.
+func (b *Bot) readEmojiEvents(since time.Time) ([]*emojiEvent, error) {
+	b.emojiEventsLock.Lock()
+	defer b.emojiEventsLock.Unlock()
+	file, err := os.Open(b.emojiEventsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var events []*emojiEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		event := &emojiEvent{}
+		err = json.Unmarshal(scanner.Bytes(), event)
+		if err != nil {
+			return nil, err
+		}
+		if event.Time.After(since) {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// removedEmojiNames returns the names of the emojis that Socket Mode saw removed after the given time.
+func (b *Bot) removedEmojiNames(since time.Time) ([]string, error) {
+	events, err := b.readEmojiEvents(since)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, event := range events {
+		if event.Subtype == "remove" {
+			names = append(names, event.Names...)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EMOJI_SOURCE__ADMIN_LIST = "admin_list"
+	EMOJI_SOURCE__EMOJI_LIST = "emoji_list"
+
+	adminListUrlFormat = "https://%s.slack.com/api/emoji.adminList"
+	firstSeenFile      = "emojiFirstSeen.json"
+)
+
+// EmojiSource is where the list of custom emojis comes from.
+type EmojiSource interface {
+	// GetPage returns one page of emojis, sorted by upload date with the newest first. Pages start at 1.
+	GetPage(page, count int) (*SlackEmojiResponseMessage, error)
+	// HasUploaders is false if the emojis do not say who uploaded them. Features that credit
+	// uploaders are skipped then.
+	HasUploaders() bool
+}
+
+func (b *Bot) newEmojiSource() (EmojiSource, error) {
+	switch b.config.EmojiSource {
+	case EMOJI_SOURCE__ADMIN_LIST:
+		return &adminListSource{
+			url:     fmt.Sprintf(adminListUrlFormat, b.config.WorkspaceDomain),
+			token:   b.config.OwnerUserOauthToken,
+			cookie:  b.config.OwnerUserCookie,
+			retrier: b.retrier,
+			client:  &http.Client{Timeout: time.Minute},
+		}, nil
+	case EMOJI_SOURCE__EMOJI_LIST:
+		return &emojiListSource{client: b.slack, clock: b.clock, firstSeenDir: b.dataDir + stateDir}, nil
+	}
+	return nil, fmt.Errorf("unknown emoji source %q", b.config.EmojiSource)
+}
+
+// adminListSource uses the undocumented emoji.adminList endpoint that the Slack website uses.
+// It needs the token and cookie of a user, but it has upload times and uploaders.
+type adminListSource struct {
+	url     string
+	token   string
+	cookie  string
+	retrier *retrier
+	client  *http.Client
+}
+
+func (s *adminListSource) HasUploaders() bool {
+	return true
+}
+
+func (s *adminListSource) GetPage(page, count int) (*SlackEmojiResponseMessage, error) {
+	vals := url.Values{}
+	vals.Set("token", s.token)
+	vals.Set("page", strconv.Itoa(page))
+	vals.Set("count", strconv.Itoa(count))
+	vals.Set("sort_by", "created")
+	vals.Set("sort_dir", "desc")
+	vals.Set("_x_mode", "online")
+
+	var parsed *SlackEmojiResponseMessage
+	err := s.retrier.do("emoji.adminList", func() error {
+		req, err := http.NewRequest("POST", s.url, strings.NewReader(vals.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("cookie", s.cookie)
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		err = checkStatusCode(resp)
+		if err != nil {
+			return err
+		}
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		parsed, err = parseEmojiResponse(bodyBytes)
+		return err
+	})
+	return parsed, err
+}
+
+// emojiListSource uses the official emoji.list API with the bot token. It only has names and
+// URLs, so the upload time of an emoji is when the bot first saw it, and there are no uploaders.
+type emojiListSource struct {
+	client SlackClient
+	clock  Clock
+	// Where the first seen times are saved.
+	firstSeenDir string
+}
+
+func (s *emojiListSource) HasUploaders() bool {
+	return false
+}
+
+func (s *emojiListSource) GetPage(page, count int) (*SlackEmojiResponseMessage, error) {
+	if page != 1 {
+		return nil, fmt.Errorf("emoji.list has a single page, page %d was requested", page)
+	}
+	emojiUrls, err := s.client.GetEmoji()
+	if err != nil {
+		return nil, err
+	}
+	firstSeen, err := updateFirstSeen(s.firstSeenDir, emojiUrls, s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	response := &SlackEmojiResponseMessage{
+		Ok:                    true,
+		Emoji:                 make([]*Emoji, 0, len(emojiUrls)),
+		CustomEmojiTotalCount: int64(len(emojiUrls)),
+		Paging:                PagingResponse{Count: len(emojiUrls), Total: len(emojiUrls), Page: 1, Pages: 1},
+	}
+	for name, value := range emojiUrls {
+		newEmoji := &Emoji{Name: name, Url: value, Created: int(firstSeen[name])}
+		if strings.HasPrefix(value, "alias:") {
+			newEmoji.IsAlias = 1
+			newEmoji.AliasFor = strings.TrimPrefix(value, "alias:")
+			newEmoji.Url = ""
+		}
+		response.Emoji = append(response.Emoji, newEmoji)
+	}
+	sort.Slice(response.Emoji, func(i, j int) bool {
+		if response.Emoji[i].Created == response.Emoji[j].Created {
+			return response.Emoji[i].Name < response.Emoji[j].Name
+		}
+		return response.Emoji[i].Created > response.Emoji[j].Created
+	})
+	return response, nil
+}
+
+// updateFirstSeen saves when each emoji was first seen, and returns the times as unix seconds.
+// The emojis that exist the first time this runs are saved as 0, since it is not known when they were uploaded.
+func updateFirstSeen(dir string, emojiUrls map[string]string, seenAt time.Time) (map[string]int64, error) {
+	fileName := dir + firstSeenFile
+	firstSeen := map[string]int64{}
+	contents, err := ioutil.ReadFile(fileName)
+	firstTime := os.IsNotExist(err)
+	if err != nil && !firstTime {
+		return nil, err
+	} else if err == nil {
+		err = json.Unmarshal(contents, &firstSeen)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := seenAt.Unix()
+	for name := range emojiUrls {
+		if _, ok := firstSeen[name]; !ok {
+			if firstTime {
+				firstSeen[name] = 0
+			} else {
+				firstSeen[name] = now
+			}
+		}
+	}
+	// Forget deleted emojis, so that they are new again if they are uploaded again.
+	for name := range firstSeen {
+		if _, ok := emojiUrls[name]; !ok {
+			delete(firstSeen, name)
+		}
+	}
+
+	err = ensureDirExists(dir)
+	if err != nil {
+		return nil, err
+	}
+	firstSeenBytes, err := json.Marshal(firstSeen)
+	if err != nil {
+		return nil, err
+	}
+	return firstSeen, ioutil.WriteFile(fileName, firstSeenBytes, 0644)
+}
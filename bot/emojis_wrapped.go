@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ryho/slack-emoji-bot/util"
+	"github.com/slack-go/slack"
+)
+
+// DefaultWrappedYear is the year that Emojis Wrapped is about. In January, that is the previous year.
+func (b *Bot) DefaultWrappedYear() int {
+	rightNow := b.now()
+	year := rightNow.Year()
+	if rightNow.Month() == time.January {
+		year--
+	}
+	return year
+}
+
+// RunWrapped posts the top voted emojis of the year.
+func (b *Bot) RunWrapped(year int) error {
+	return b.report("wrapped", func() error {
+		allEmojis, err := b.allEmojis()
+		if err != nil {
+			return err
+		}
+		return b.emojisWrapped(allEmojis, year)
+	})
+}
+
+func (b *Bot) emojisWrapped(allEmojis *SlackEmojiResponseMessage, year int) error {
+	// Get the emojis channel
+	emojiChannelID, err := b.getChannel(b.config.EmojiChannel)
+	if err != nil {
+		return err
+	}
+	messages, err := b.findAllVotePrompts(emojiChannelID, year)
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		timestamp, err := timeFromMessage(msg)
+		if err != nil {
+			return err
+		}
+		voters := map[string]util.SetEntry{}
+		for _, reaction := range msg.Reactions {
+			for _, user := range reaction.Users {
+				voters[user] = util.SetEntry{}
+			}
+		}
+		fmt.Fprintf(b.out, "Reactions %v, voters %v, date %v\n", len(msg.Reactions), len(voters), timestamp)
+	}
+	return b.printTopEmojisByReactionVote(allEmojis, year, 100, messages...)
+}
+
+// voteResultGap is the longest time between two weekly vote prompts. Where the saved vote results are
+// further apart than that, some prompts were never counted.
+const voteResultGap = 8 * 24 * time.Hour
+
+// findAllVotePrompts finds the vote prompts that were posted during the given year. The votes that were
+// saved to the history are used, and the channel history is only read where some prompts were not saved,
+// and before and after the saved ones, since the newest prompt is only counted a week later.
+func (b *Bot) findAllVotePrompts(emojiChannelId string, year int) ([]*slack.Message, error) {
+	location, err := b.config.Location()
+	if err != nil {
+		return nil, err
+	}
+	startOfYear := time.Date(year, time.January, 1, 0, 0, 0, 0, location)
+	endOfYear := startOfYear.AddDate(1, 0, 0)
+	results, err := b.voteResults(startOfYear, endOfYear)
+	if err != nil {
+		return nil, err
+	}
+	var reactionMessages []*slack.Message
+	oldest, oldestTime := strconv.FormatInt(startOfYear.Unix(), 10), startOfYear
+	for _, result := range results {
+		if !result.hasVoters() {
+			continue
+		}
+		if oldestTime == startOfYear || result.Time.Sub(oldestTime) > voteResultGap {
+			missed, err := b.findVotePrompts(emojiChannelId, oldest, result.VoteMessageTS)
+			if err != nil {
+				return nil, err
+			}
+			reactionMessages = append(reactionMessages, missed...)
+		}
+		reactionMessages = append(reactionMessages, result.message())
+		oldest, oldestTime = result.VoteMessageTS, result.Time
+	}
+	missed, err := b.findVotePrompts(emojiChannelId, oldest, strconv.FormatInt(endOfYear.Unix(), 10))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(b.out, "%d vote prompts were saved, and %d more were read from Slack\n", len(reactionMessages), len(missed))
+	return append(reactionMessages, missed...), nil
+}
+
+// findVotePrompts reads the vote prompts that were posted between the two timestamps from the channel,
+// oldest first.
+func (b *Bot) findVotePrompts(emojiChannelId string, oldest, latest string) ([]*slack.Message, error) {
+	conversationParams := &slack.GetConversationHistoryParameters{
+		ChannelID: emojiChannelId,
+		Oldest:    oldest,
+		Latest:    latest,
+	}
+	var reactionMessages []*slack.Message
+	for true {
+		messages, err := b.slack.GetConversationHistory(conversationParams)
+		if err != nil {
+			return nil, err
+		}
+		for i, message := range messages.Messages {
+			if message.Text == votePrompt || message.Text == votePromptPrevious {
+				reactionMessages = append(reactionMessages, &messages.Messages[i])
+			}
+		}
+		if len(messages.ResponseMetaData.NextCursor) == 0 {
+			break
+		}
+		conversationParams.Cursor = messages.ResponseMetaData.NextCursor
+	}
+	// The history is newest first.
+	for i, j := 0, len(reactionMessages)-1; i < j; i, j = i+1, j-1 {
+		reactionMessages[i], reactionMessages[j] = reactionMessages[j], reactionMessages[i]
+	}
+	return reactionMessages, nil
+}
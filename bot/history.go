@@ -0,0 +1,624 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ryho/slack-emoji-bot/util"
+	"github.com/slack-go/slack"
+	bolt "go.etcd.io/bbolt"
+)
+
+const historyFile = "history.db"
+
+var (
+	// Every emoji that was ever seen, by name.
+	historyEmojisBucket = []byte("emojis")
+	// The result of every vote prompt, by the timestamp of the prompt.
+	historyVotesBucket = []byte("votes")
+	// The images in the image cache, by the URL they were downloaded from.
+	historyImagesBucket = []byte("images")
+	// The images that each emoji had over time, by emoji name.
+	historyImageVersionsBucket = []byte("image_versions")
+	// Facts about the history itself, like historySyncKey.
+	historyMetaBucket = []byte("meta")
+	historySyncKey    = []byte("sync")
+)
+
+// historySync is how far back the history is known to have every emoji. The emoji_changed events that serve
+// saves only fill it in while serve is listening, so emojis uploaded while it was down are only found by
+// downloading the emojis again.
+type historySync struct {
+	// When the emojis were downloaded.
+	Time time.Time `json:"time"`
+	// The upload time of the newest emoji in that download, as unix seconds. The history has every emoji
+	// uploaded up to then.
+	Through int64 `json:"through"`
+}
+
+// emojiRecord is everything the history knows about one emoji.
+type emojiRecord struct {
+	Name            string `json:"name"`
+	AliasFor        string `json:"alias_for,omitempty"`
+	Url             string `json:"url,omitempty"`
+	Created         int64  `json:"created"`
+	UserId          string `json:"user_id,omitempty"`
+	UserDisplayName string `json:"user_display_name,omitempty"`
+	// The sha256 of the current image, once it was downloaded with cache_images.
+	ImageHash string    `json:"image_hash,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// When the emoji was found to be gone, or zero if it still exists.
+	Removed time.Time `json:"removed"`
+	// The new name, if the emoji was renamed.
+	RenamedTo string `json:"renamed_to,omitempty"`
+}
+
+func (r *emojiRecord) emoji() *Emoji {
+	isAlias := 0
+	if r.AliasFor != "" {
+		isAlias = 1
+	}
+	return &Emoji{
+		Name:            r.Name,
+		IsAlias:         isAlias,
+		AliasFor:        r.AliasFor,
+		Url:             r.Url,
+		Created:         int(r.Created),
+		UserId:          r.UserId,
+		UserDisplayName: r.UserDisplayName,
+	}
+}
+
+// voteResult is how one vote prompt was voted on.
+type voteResult struct {
+	VoteMessageTS string        `json:"vote_message_ts"`
+	Time          time.Time     `json:"time"`
+	Voters        int           `json:"voters"`
+	Votes         []*emojiVotes `json:"votes"`
+	// Who posted the vote prompt, for ignore_bot_votes.
+	User  string `json:"user,omitempty"`
+	BotID string `json:"bot_id,omitempty"`
+}
+
+type emojiVotes struct {
+	Emoji string `json:"emoji"`
+	Votes int    `json:"votes"`
+	// Who voted for the emoji. Slack only lists some of them for reactions with a lot of votes.
+	Users []string `json:"users,omitempty"`
+	// The emoji that Emoji is an alias for, if it is one.
+	AliasFor string `json:"alias_for,omitempty"`
+	// Who uploaded the emoji, or the emoji it is an alias for, if that is known.
+	UserId string `json:"user_id,omitempty"`
+}
+
+func (b *Bot) historyPath() string {
+	return b.dataDir + stateDir + historyFile
+}
+
+// history opens the history database the first time it is needed. It stays open until Close, since
+// opening it takes the file lock and makes sure that the buckets exist.
+func (b *Bot) history() (*bolt.DB, error) {
+	b.historyLock.Lock()
+	defer b.historyLock.Unlock()
+	if b.historyDB != nil {
+		return b.historyDB, nil
+	}
+	err := ensureDirExists(b.dataDir + stateDir)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(b.historyPath(), 0644, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the emoji history: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{historyEmojisBucket, historyVotesBucket, historyImagesBucket, historyImageVersionsBucket, historyMetaBucket} {
+			_, err := tx.CreateBucketIfNotExists(bucket)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	b.historyDB = db
+	return db, nil
+}
+
+// closeHistory closes the history database, if it was opened.
+func (b *Bot) closeHistory() error {
+	b.historyLock.Lock()
+	defer b.historyLock.Unlock()
+	if b.historyDB == nil {
+		return nil
+	}
+	err := b.historyDB.Close()
+	b.historyDB = nil
+	return err
+}
+
+// withHistory runs fn in a transaction on the history database. The buckets always exist.
+func (b *Bot) withHistory(writable bool, fn func(tx *bolt.Tx) error) error {
+	db, err := b.history()
+	if err != nil {
+		return err
+	}
+	if writable {
+		return db.Update(fn)
+	}
+	return db.View(fn)
+}
+
+func getEmojiRecord(tx *bolt.Tx, name string) (*emojiRecord, error) {
+	value := tx.Bucket(historyEmojisBucket).Get([]byte(name))
+	if value == nil {
+		return nil, nil
+	}
+	record := &emojiRecord{}
+	err := json.Unmarshal(value, record)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %v from the emoji history: %w", name, err)
+	}
+	return record, nil
+}
+
+func putEmojiRecord(tx *bolt.Tx, record *emojiRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(historyEmojisBucket).Put([]byte(record.Name), value)
+}
+
+func forEachEmojiRecord(tx *bolt.Tx, fn func(record *emojiRecord) error) error {
+	return tx.Bucket(historyEmojisBucket).ForEach(func(key, value []byte) error {
+		record := &emojiRecord{}
+		err := json.Unmarshal(value, record)
+		if err != nil {
+			return fmt.Errorf("unable to read %s from the emoji history: %w", key, err)
+		}
+		return fn(record)
+	})
+}
+
+// recordSeenEmojis saves the emojis to the history as seen now. If complete is set, the emojis are every
+// emoji of the workspace, and the ones in the history that are not among them are marked as removed.
+func (b *Bot) recordSeenEmojis(emojis []*Emoji, complete bool) error {
+	now := b.now()
+	return b.withHistory(true, func(tx *bolt.Tx) error {
+		seen := make(map[string]bool, len(emojis))
+		for _, emoji := range emojis {
+			seen[emoji.Name] = true
+			record, err := getEmojiRecord(tx, emoji.Name)
+			if err != nil {
+				return err
+			}
+			if record == nil || !record.Removed.IsZero() {
+				// An emoji that was removed and then uploaded again with the same name is a new emoji.
+				record = &emojiRecord{Name: emoji.Name, FirstSeen: now}
+			}
+			record.AliasFor = emoji.AliasFor
+			if record.Url != emoji.Url {
+				record.ImageHash = ""
+			}
+			record.Url = emoji.Url
+			record.Created = int64(emoji.Created)
+			if emoji.UserId != "" {
+				record.UserId = emoji.UserId
+				record.UserDisplayName = emoji.UserDisplayName
+			}
+			record.LastSeen = now
+			err = putEmojiRecord(tx, record)
+			if err != nil {
+				return err
+			}
+		}
+		if !complete {
+			return nil
+		}
+		err := putHistorySync(tx, &historySync{Time: now, Through: newestCreated(emojis)})
+		if err != nil {
+			return err
+		}
+		var gone []*emojiRecord
+		err = forEachEmojiRecord(tx, func(record *emojiRecord) error {
+			if !seen[record.Name] && record.Removed.IsZero() {
+				gone = append(gone, record)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, record := range gone {
+			record.Removed = now
+			err = putEmojiRecord(tx, record)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func newestCreated(emojis []*Emoji) int64 {
+	var newest int64
+	for _, emoji := range emojis {
+		if int64(emoji.Created) > newest {
+			newest = int64(emoji.Created)
+		}
+	}
+	return newest
+}
+
+func getHistorySync(tx *bolt.Tx) (*historySync, error) {
+	value := tx.Bucket(historyMetaBucket).Get(historySyncKey)
+	if value == nil {
+		return nil, nil
+	}
+	sync := &historySync{}
+	err := json.Unmarshal(value, sync)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read when the emoji history was last downloaded: %w", err)
+	}
+	return sync, nil
+}
+
+func putHistorySync(tx *bolt.Tx, sync *historySync) error {
+	value, err := json.Marshal(sync)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(historyMetaBucket).Put(historySyncKey, value)
+}
+
+// recordEmojiEventInHistory applies an emoji_changed event to the history.
+func (b *Bot) recordEmojiEventInHistory(event *emojiEvent) error {
+	return b.withHistory(true, func(tx *bolt.Tx) error {
+		switch event.Subtype {
+		case "add":
+			record := &emojiRecord{Name: event.Name, Created: event.Time.Unix(), FirstSeen: event.Time, LastSeen: event.Time}
+			if strings.HasPrefix(event.Value, "alias:") {
+				record.AliasFor = strings.TrimPrefix(event.Value, "alias:")
+			} else {
+				record.Url = event.Value
+			}
+			return putEmojiRecord(tx, record)
+		case "remove":
+			for _, name := range event.Names {
+				record, err := getEmojiRecord(tx, name)
+				if err != nil {
+					return err
+				}
+				if record == nil {
+					record = &emojiRecord{Name: name, FirstSeen: event.Time, LastSeen: event.Time}
+				}
+				record.Removed = event.Time
+				err = putEmojiRecord(tx, record)
+				if err != nil {
+					return err
+				}
+			}
+		case "rename":
+			old, err := getEmojiRecord(tx, event.OldName)
+			if err != nil {
+				return err
+			}
+			renamed := &emojiRecord{Name: event.NewName, Url: event.Value, Created: event.Time.Unix(), FirstSeen: event.Time}
+			if old != nil {
+				copied := *old
+				renamed = &copied
+				renamed.Name = event.NewName
+				renamed.Removed = time.Time{}
+			} else {
+				old = &emojiRecord{Name: event.OldName, FirstSeen: event.Time}
+			}
+			renamed.LastSeen = event.Time
+			old.Removed = event.Time
+			old.RenamedTo = event.NewName
+			err = putEmojiRecord(tx, old)
+			if err != nil {
+				return err
+			}
+			return putEmojiRecord(tx, renamed)
+		}
+		return nil
+	})
+}
+
+// recordCachedImages saves which image each emoji has. An emoji gets a new image version when its image changed.
+func (b *Bot) recordCachedImages(downloads []*imageDownload) error {
+	if len(downloads) == 0 {
+		return nil
+	}
+	now := b.now()
+	return b.withHistory(true, func(tx *bolt.Tx) error {
+		for _, download := range downloads {
+			value, err := json.Marshal(download.image)
+			if err != nil {
+				return err
+			}
+			err = tx.Bucket(historyImagesBucket).Put([]byte(imageUrlKey(download.url)), value)
+			if err != nil {
+				return err
+			}
+			versions, err := getImageVersions(tx, download.name)
+			if err != nil {
+				return err
+			}
+			if len(versions) == 0 || versions[len(versions)-1].Hash != download.image.Hash {
+				versions = append(versions, &imageVersion{Hash: download.image.Hash, Url: download.url, Seen: now})
+				value, err = json.Marshal(versions)
+				if err != nil {
+					return err
+				}
+				err = tx.Bucket(historyImageVersionsBucket).Put([]byte(download.name), value)
+				if err != nil {
+					return err
+				}
+			}
+			record, err := getEmojiRecord(tx, download.name)
+			if err != nil {
+				return err
+			}
+			if record != nil && record.Url == download.url && record.ImageHash != download.image.Hash {
+				record.ImageHash = download.image.Hash
+				err = putEmojiRecord(tx, record)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func getImageVersions(tx *bolt.Tx, name string) ([]*imageVersion, error) {
+	value := tx.Bucket(historyImageVersionsBucket).Get([]byte(name))
+	if value == nil {
+		return nil, nil
+	}
+	var versions []*imageVersion
+	err := json.Unmarshal(value, &versions)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the images of %v from the history: %w", name, err)
+	}
+	return versions, nil
+}
+
+// imageVersions returns the images that the emoji had, oldest first.
+func (b *Bot) imageVersions(name string) ([]*imageVersion, error) {
+	var versions []*imageVersion
+	err := b.withHistory(false, func(tx *bolt.Tx) error {
+		var err error
+		versions, err = getImageVersions(tx, name)
+		return err
+	})
+	return versions, err
+}
+
+// cachedImagesByUrl returns the images in the image cache, by the imageUrlKey of the URL they were downloaded from.
+func (b *Bot) cachedImagesByUrl() (map[string]*cachedImage, error) {
+	images := map[string]*cachedImage{}
+	err := b.withHistory(false, func(tx *bolt.Tx) error {
+		return tx.Bucket(historyImagesBucket).ForEach(func(key, value []byte) error {
+			image := &cachedImage{}
+			err := json.Unmarshal(value, image)
+			if err != nil {
+				return fmt.Errorf("unable to read the image of %s from the history: %w", key, err)
+			}
+			images[string(key)] = image
+			return nil
+		})
+	})
+	return images, err
+}
+
+// imageHashesByUrl returns the hashes of the images in the image cache, by the imageUrlKey of their URL.
+func (b *Bot) imageHashesByUrl() (map[string]string, error) {
+	images, err := b.cachedImagesByUrl()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(images))
+	for url, image := range images {
+		hashes[url] = image.Hash
+	}
+	return hashes, nil
+}
+
+// emojiHistory returns what the history knows about an emoji, or nil if it was never seen.
+func (b *Bot) emojiHistory(name string) (*emojiRecord, error) {
+	var record *emojiRecord
+	err := b.withHistory(false, func(tx *bolt.Tx) error {
+		var err error
+		record, err = getEmojiRecord(tx, name)
+		return err
+	})
+	return record, err
+}
+
+// historyEmojis returns the emojis in the history that were not removed, newest first, like emoji.adminList.
+func (b *Bot) historyEmojis() (*SlackEmojiResponseMessage, error) {
+	response := &SlackEmojiResponseMessage{Ok: true}
+	err := b.withHistory(false, func(tx *bolt.Tx) error {
+		return forEachEmojiRecord(tx, func(record *emojiRecord) error {
+			if record.Removed.IsZero() {
+				response.Emoji = append(response.Emoji, record.emoji())
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Stable(EmojiUploadDateSort(response.Emoji))
+	response.CustomEmojiTotalCount = int64(len(response.Emoji))
+	response.emojiMap = make(map[string]*Emoji, len(response.Emoji))
+	for i, emoji := range response.Emoji {
+		response.emojiMap[emoji.Name] = response.Emoji[i]
+	}
+	return response, nil
+}
+
+// getAllEmojisFromHistory returns every emoji, reading the ones that were seen before from the history and
+// only downloading the pages with the emojis uploaded since. The emoji_changed events are only trusted to fill
+// in the history while serve has been listening since the last download. Otherwise the pages go back to that
+// download, so that the emojis uploaded while serve was down are found. Emojis that were deleted since the
+// last full download are only left out if serve saw them removed. Without a history, or one that does not
+// say when it was downloaded, every emoji is downloaded.
+func (b *Bot) getAllEmojisFromHistory() (*SlackEmojiResponseMessage, error) {
+	known, err := b.historyEmojis()
+	if err != nil {
+		return nil, err
+	}
+	var sync *historySync
+	err = b.withHistory(false, func(tx *bolt.Tx) error {
+		sync, err = getHistorySync(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(known.Emoji) == 0 || sync == nil {
+		return b.getAllEmojis()
+	}
+	fmt.Fprintf(b.out, "Read %v emojis from the history\n", len(known.Emoji))
+	started := b.now()
+	stopName, stopCreated := "", sync.Through
+	if listening := b.listeningSince(); !listening.IsZero() && !listening.After(sync.Time) {
+		stopName, stopCreated = known.Emoji[0].Name, int64(known.Emoji[0].Created)
+	} else {
+		fmt.Fprintf(b.out, "serve was not listening for emoji events the whole time since the emojis were downloaded on %v, "+
+			"so getting every emoji uploaded since then\n", sync.Time.Format(time.RFC1123))
+	}
+	newEmojis, err := b.getEmojisBackTo(stopName, stopCreated)
+	if err != nil {
+		return nil, err
+	}
+	for _, emoji := range newEmojis.Emoji {
+		if _, ok := known.emojiMap[emoji.Name]; !ok {
+			known.Emoji = append(known.Emoji, emoji)
+		}
+		known.emojiMap[emoji.Name] = emoji
+	}
+	for i, emoji := range known.Emoji {
+		known.Emoji[i] = known.emojiMap[emoji.Name]
+	}
+	sort.Stable(EmojiUploadDateSort(known.Emoji))
+	known.CustomEmojiTotalCount = int64(len(known.Emoji))
+	if through := newestCreated(newEmojis.Emoji); through > sync.Through {
+		sync.Through = through
+	}
+	sync.Time = started
+	err = b.withHistory(true, func(tx *bolt.Tx) error {
+		return putHistorySync(tx, sync)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return known, nil
+}
+
+// recordVoteResults saves how the vote prompts were voted on. Counting a prompt again replaces its result.
+func (b *Bot) recordVoteResults(results []*voteResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	return b.withHistory(true, func(tx *bolt.Tx) error {
+		for _, result := range results {
+			value, err := json.Marshal(result)
+			if err != nil {
+				return err
+			}
+			err = tx.Bucket(historyVotesBucket).Put([]byte(result.VoteMessageTS), value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// recordVotePrompts saves the votes on each of the vote prompts to the history.
+func (b *Bot) recordVotePrompts(resolver *emojiResolver, messages []*slack.Message) error {
+	var results []*voteResult
+	for _, message := range messages {
+		timestamp, err := timeFromMessage(message)
+		if err != nil {
+			return err
+		}
+		result := &voteResult{VoteMessageTS: message.Timestamp, Time: timestamp, User: message.User, BotID: message.BotID}
+		voters := util.StringSet{}
+		for _, reaction := range message.Reactions {
+			votes := &emojiVotes{Emoji: reaction.Name, Votes: reaction.Count, Users: reaction.Users}
+			emoji, alias, err := resolver.resolve(reaction.Name)
+			if err != nil {
+				return err
+			}
+			if emoji != nil {
+				votes.UserId = emoji.UserId
+			}
+			if alias != nil {
+				votes.AliasFor = emoji.Name
+			}
+			result.Votes = append(result.Votes, votes)
+			for _, user := range reaction.Users {
+				voters[user] = util.SetEntry{}
+			}
+		}
+		result.Voters = len(voters)
+		results = append(results, result)
+	}
+	return b.recordVoteResults(results)
+}
+
+// hasVoters is false for results that were saved before the voters were, which cannot be counted again.
+func (r *voteResult) hasVoters() bool {
+	for _, votes := range r.Votes {
+		if votes.Votes > 0 && len(votes.Users) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// message is the vote prompt as it was when the result was saved, so that its votes can be counted again.
+func (r *voteResult) message() *slack.Message {
+	message := &slack.Message{}
+	message.Timestamp = r.VoteMessageTS
+	message.Text = votePrompt
+	message.User = r.User
+	message.BotID = r.BotID
+	for _, votes := range r.Votes {
+		message.Reactions = append(message.Reactions, slack.ItemReaction{Name: votes.Emoji, Count: votes.Votes, Users: votes.Users})
+	}
+	return message
+}
+
+// voteResults returns the saved vote results from the time range, oldest first.
+func (b *Bot) voteResults(from, to time.Time) ([]*voteResult, error) {
+	var results []*voteResult
+	err := b.withHistory(false, func(tx *bolt.Tx) error {
+		return tx.Bucket(historyVotesBucket).ForEach(func(key, value []byte) error {
+			result := &voteResult{}
+			err := json.Unmarshal(value, result)
+			if err != nil {
+				return fmt.Errorf("unable to read the vote %s from the history: %w", key, err)
+			}
+			if !result.Time.Before(from) && result.Time.Before(to) {
+				results = append(results, result)
+			}
+			return nil
+		})
+	})
+	sort.Slice(results, func(i, j int) bool { return results[i].Time.Before(results[j].Time) })
+	return results, err
+}
@@ -0,0 +1,237 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestHistoryRemembersEmojisAndVotes(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 2*24*time.Hour)
+	addEmoji(server, "new-two", "U2", 24*time.Hour)
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := b.emojiHistory("new-one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || record.UserId != "U1" || record.Url != "https://emoji.example.com/new-one.png" || record.FirstSeen.IsZero() || !record.Removed.IsZero() {
+		t.Fatalf("unexpected history of new-one: %+v", record)
+	}
+	firstSeen := record.FirstSeen
+
+	state, err := b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	voteTS := state.lastRun().VoteMessageTS
+	err = server.AddReaction(testChannelId, voteTS, "new-one", "U1", "U2", "U3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addEmoji(server, "new-three", "U3", time.Hour)
+	b.resetRunState()
+	err = b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fast mode only downloads the new emojis, but deleted downloads all of them.
+	server.RemoveEmoji("new-two")
+	err = b.RunDeleted()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err = b.emojiHistory("new-one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.FirstSeen.Equal(firstSeen) || record.LastSeen.Before(firstSeen) {
+		t.Errorf("seeing new-one again changed when it was first seen: %+v", record)
+	}
+	record, err = b.emojiHistory("new-two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || record.Removed.IsZero() {
+		t.Errorf("new-two was not marked as removed: %+v", record)
+	}
+	results, err := b.voteResults(time.Time{}, b.now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].VoteMessageTS != voteTS || results[0].Voters != 3 ||
+		len(results[0].Votes) != 1 || results[0].Votes[0].Votes != 3 || results[0].Votes[0].UserId != "U1" {
+		t.Errorf("unexpected vote results %+v", results)
+	}
+}
+
+func TestWrappedCountsTheSavedVotes(t *testing.T) {
+	b, server := setupWeekly(t)
+	b.config.TimeZone = "UTC"
+	addEmoji(server, "new-one", "U1", 2*24*time.Hour)
+	addEmoji(server, "new-two", "U2", 24*time.Hour)
+	addPrompt := func(month time.Month, day int, name string, users ...string) string {
+		ts := fmt.Sprintf("%d.000100", time.Date(2025, month, day, 12, 0, 0, 0, time.UTC).Unix())
+		server.AddMessage(testChannelId, slack.Message{Msg: slack.Msg{Text: votePrompt, Timestamp: ts}})
+		err := server.AddReaction(testChannelId, ts, name, users...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	saved := []string{
+		addPrompt(time.March, 1, "new-one", "U1", "U2", "U3"),
+		addPrompt(time.April, 5, "new-one", "U2"),
+	}
+	allEmojis, err := b.getAllEmojis()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prompts []*slack.Message
+	for _, message := range server.History(testChannelId) {
+		message := message
+		prompts = append(prompts, &message)
+	}
+	err = b.recordVotePrompts(b.emojiResolver(allEmojis), prompts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Votes after the prompt was counted do not change its saved result.
+	err = server.AddReaction(testChannelId, saved[0], "new-two", "U1", "U2", "U3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// This prompt was never counted, so it is read from Slack.
+	addPrompt(time.March, 22, "new-two", "U1", "U2", "U3")
+
+	err = b.RunWrapped(2025)
+	if err != nil {
+		t.Fatal(err)
+	}
+	winners := findPosted(t, postedTo(server, b.config.EmojiChannel), "2025")
+	for _, want := range []string{":new-one: 4", ":new-two: 3"} {
+		if !strings.Contains(winners, want) {
+			t.Errorf("%q is not in %q", want, winners)
+		}
+	}
+}
+
+func TestHistoryFollowsEmojiEvents(t *testing.T) {
+	b, _ := setupWeekly(t)
+	events := []*slackevents.EmojiChangedEvent{
+		{Subtype: "add", Name: "party", Value: "https://emoji.example.com/party.png"},
+		{Subtype: "add", Name: "fiesta", Value: "alias:party"},
+		{Subtype: "rename", OldName: "party", NewName: "party-parrot", Value: "https://emoji.example.com/party.png"},
+		{Subtype: "remove", Names: []string{"fiesta"}},
+	}
+	for _, event := range events {
+		err := b.handleEmojiChanged(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old, err := b.emojiHistory("party")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old == nil || old.RenamedTo != "party-parrot" || old.Removed.IsZero() {
+		t.Errorf("party is not marked as renamed: %+v", old)
+	}
+	renamed, err := b.emojiHistory("party-parrot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed == nil || !renamed.Removed.IsZero() || !renamed.FirstSeen.Equal(old.FirstSeen) {
+		t.Errorf("party-parrot did not keep the history of party: %+v", renamed)
+	}
+	alias, err := b.emojiHistory("fiesta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alias == nil || alias.AliasFor != "party" || alias.Removed.IsZero() {
+		t.Errorf("unexpected history of the alias fiesta: %+v", alias)
+	}
+}
+
+func TestFastModeReadsEmojisFromHistory(t *testing.T) {
+	b, server := setupWeekly(t)
+	b.config.FastMode = true
+	// Downloaded by an earlier run, so it is in the history, but not in the pages of emoji.adminList that
+	// are downloaded again.
+	err := b.recordSeenEmojis([]*Emoji{{Name: "only-in-the-history-with-a-long-name", Created: int(b.now().Add(-60 * 24 * time.Hour).Unix()), UserId: "U2"}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addEmoji(server, "brand-new", "U3", time.Hour)
+
+	var out bytes.Buffer
+	b.out = &out
+	err = b.RunLongest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	longest := out.String()
+	for _, name := range []string{"only-in-the-history-with-a-long-name", "brand-new"} {
+		if !strings.Contains(longest, ":"+name+":") {
+			t.Errorf("%v is missing from %q", name, longest)
+		}
+	}
+}
+
+// onePerPage pages through the emojis one at a time, so that tests can see which pages were downloaded.
+type onePerPage struct {
+	EmojiSource
+}
+
+func (s onePerPage) GetPage(page, count int) (*SlackEmojiResponseMessage, error) {
+	return s.EmojiSource.GetPage(page, 1)
+}
+
+func TestFastModeFindsEmojisUploadedWhileServeWasDown(t *testing.T) {
+	b, server := setupWeekly(t)
+	b.config.FastMode = true
+	b.emojiSource = onePerPage{b.emojiSource}
+	_, err := b.getAllEmojis()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Uploaded while serve was down, and then serve saw a newer emoji uploaded after it started again.
+	addEmoji(server, "while-down", "U2", 2*time.Hour)
+	addEmoji(server, "after-restart", "U3", time.Hour)
+	err = b.handleEmojiChanged(&slackevents.EmojiChangedEvent{Subtype: "add", Name: "after-restart", Value: "https://emoji.example.com/after-restart.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emojis, err := b.allEmojis()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"old-emoji", "while-down", "after-restart"} {
+		if _, ok := emojis.emojiMap[name]; !ok {
+			t.Errorf("%v is missing from %v", name, emojiNames(emojis.Emoji))
+		}
+	}
+	// The emojis were downloaded back to the last download, so the next run can trust the events.
+	err = b.withHistory(false, func(tx *bolt.Tx) error {
+		sync, err := getHistorySync(tx)
+		if err == nil && (sync == nil || sync.Through < int64(emojis.emojiMap["after-restart"].Created)) {
+			t.Errorf("the history was not marked as downloaded: %+v", sync)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
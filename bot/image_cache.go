@@ -0,0 +1,272 @@
+package bot
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The images are named after the sha256 of their contents, in this directory of imagesDir.
+	imageObjectsDir = "sha256/"
+	// Downloads are written to files with this suffix, and renamed when they are done.
+	partialDownloadSuffix = ".partial"
+	// How many downloaded images are saved to the history at once. A cache that was stopped part way
+	// resumes from the last batch that was saved.
+	imageRecordBatch = 50
+	// Emojis are at most 128KB, so anything much bigger is not an emoji.
+	maxImageBytes = 16 << 20
+)
+
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+}
+
+// cachedImage is an image in the content addressed image cache.
+type cachedImage struct {
+	Hash string `json:"hash"`
+	// The name of the file in the cache, which is the hash and an extension.
+	File        string `json:"file"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// See perceptualHash. Empty for images that Go can not decode, like WebP.
+	PerceptualHash string `json:"perceptual_hash,omitempty"`
+}
+
+// imageVersion is an image that an emoji had. An emoji has several if it was re-uploaded.
+type imageVersion struct {
+	Hash string    `json:"hash"`
+	Url  string    `json:"url"`
+	Seen time.Time `json:"seen"`
+}
+
+// imageStore saves images to the cache.
+type imageStore struct {
+	dir    string
+	client *http.Client
+}
+
+func (b *Bot) imageStore() *imageStore {
+	return &imageStore{dir: b.dataDir + imagesDir + imageObjectsDir, client: &http.Client{Timeout: time.Minute}}
+}
+
+func (s *imageStore) path(image *cachedImage) string {
+	return s.dir + image.File
+}
+
+// fetch downloads the image, or decodes it if it is a data URL, and saves it to the cache.
+func (s *imageStore) fetch(url string) (*cachedImage, error) {
+	if strings.HasPrefix(url, "data:") {
+		// Like data:image/png;base64,iVBORw0KGgo...
+		i := strings.Index(url, ",")
+		if i < 0 || !strings.HasSuffix(url[:i], ";base64") {
+			return nil, errors.New("the data URL is not base64")
+		}
+		contentType := strings.TrimSuffix(url[len("data:"):i], ";base64")
+		decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(url[i+1:]))
+		return s.save(decoder, contentType, "")
+	}
+	resp, err := s.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got %v", resp.Status)
+	}
+	return s.save(resp.Body, resp.Header.Get("Content-Type"), path.Ext(url))
+}
+
+// save writes the image to a partial file while hashing it, and then renames it after its hash.
+// fallbackExt is used if the content type does not have a known extension.
+func (s *imageStore) save(contents io.Reader, contentType, fallbackExt string) (*cachedImage, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return nil, fmt.Errorf("the content type %q is not an image", contentType)
+	}
+	ext, ok := imageExtensions[mediaType]
+	if !ok {
+		ext = fallbackExt
+	}
+	file, err := ioutil.TempFile(s.dir, "download-*"+partialDownloadSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(contents, maxImageBytes+1))
+	closeErr := file.Close()
+	if err != nil {
+		return nil, err
+	}
+	if closeErr != nil {
+		return nil, closeErr
+	}
+	if size > maxImageBytes {
+		return nil, fmt.Errorf("the image is bigger than %v bytes", maxImageBytes)
+	}
+	image := &cachedImage{Hash: hex.EncodeToString(hash.Sum(nil)), ContentType: mediaType, Size: size}
+	image.File = image.Hash + ext
+	// The same image can be downloaded for several emojis at the same time. They have the same contents,
+	// so it does not matter which rename is the last.
+	err = os.Rename(file.Name(), s.path(image))
+	if err != nil {
+		return nil, err
+	}
+	image.PerceptualHash = perceptualHash(s.path(image))
+	return image, nil
+}
+
+// removePartialDownloads deletes the downloads that were stopped part way.
+func (s *imageStore) removePartialDownloads() error {
+	partials, err := filepath.Glob(s.dir + "*" + partialDownloadSuffix)
+	if err != nil {
+		return err
+	}
+	for _, partial := range partials {
+		err = os.Remove(partial)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// imageUrlKey is what the image cache knows an image URL by. Data URLs have the whole image in them, which is
+// too long for a key, so they are known by their hash instead.
+func imageUrlKey(url string) string {
+	if !strings.HasPrefix(url, "data:") {
+		return url
+	}
+	sum := sha256.Sum256([]byte(url))
+	return "data:sha256," + hex.EncodeToString(sum[:])
+}
+
+// imageDownload is the image of one emoji.
+type imageDownload struct {
+	name  string
+	url   string
+	image *cachedImage
+	err   error
+}
+
+// cacheEmojiImages saves the images of the emojis to the image cache. Images are only downloaded if their URL
+// is not in the cache yet, so a re-uploaded emoji is downloaded again, and a cache that was stopped part
+// way carries on where it was.
+func (b *Bot) cacheEmojiImages(response *SlackEmojiResponseMessage) error {
+	if !b.config.CacheImages {
+		return nil
+	}
+	store := b.imageStore()
+	err := ensureDirExists(store.dir)
+	if err != nil {
+		return err
+	}
+	err = store.removePartialDownloads()
+	if err != nil {
+		return err
+	}
+	cached, err := b.cachedImagesByUrl()
+	if err != nil {
+		return err
+	}
+	var known, missing []*imageDownload
+	for _, emoji := range response.Emoji {
+		if emoji.Url == "" {
+			// Aliases from emoji_list do not have their own image.
+			continue
+		}
+		download := &imageDownload{name: emoji.Name, url: emoji.Url}
+		if image, ok := cached[imageUrlKey(emoji.Url)]; ok && fileExists(store.path(image)) {
+			if image.PerceptualHash == "" {
+				// Cached before there were perceptual hashes.
+				image.PerceptualHash = perceptualHash(store.path(image))
+			}
+			download.image = image
+			known = append(known, download)
+		} else {
+			missing = append(missing, download)
+		}
+	}
+	// Emojis that are new to the history can have an image that was downloaded before.
+	err = b.recordCachedImages(known)
+	if err != nil {
+		return err
+	}
+	return b.downloadImages(store, missing)
+}
+
+// downloadImages downloads the images with image_download_workers at the same time, and saves them to the
+// history in batches. Failed downloads do not stop the others or the run, and are tried again by the next run.
+func (b *Bot) downloadImages(store *imageStore, downloads []*imageDownload) error {
+	if len(downloads) == 0 {
+		return nil
+	}
+	fmt.Fprintf(b.out, "Downloading %v emoji images\n", len(downloads))
+	workers := b.config.ImageDownloadWorkers
+	if workers > len(downloads) {
+		workers = len(downloads)
+	}
+	queue := make(chan *imageDownload)
+	finished := make(chan *imageDownload)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for download := range queue {
+				download.image, download.err = store.fetch(download.url)
+				finished <- download
+			}
+		}()
+	}
+	go func() {
+		for _, download := range downloads {
+			queue <- download
+		}
+		close(queue)
+		wg.Wait()
+		close(finished)
+	}()
+
+	var batch []*imageDownload
+	var failures []string
+	var recordErr error
+	for download := range finished {
+		if download.err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", download.name, download.err))
+			continue
+		}
+		batch = append(batch, download)
+		if len(batch) == imageRecordBatch && recordErr == nil {
+			recordErr = b.recordCachedImages(batch)
+			batch = nil
+		}
+	}
+	if recordErr != nil {
+		return recordErr
+	}
+	err := b.recordCachedImages(batch)
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(b.out, "Unable to download %v of %v emoji images:\n%v\n", len(failures), len(downloads), strings.Join(failures, "\n"))
+	}
+	return nil
+}
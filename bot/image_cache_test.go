@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// imageServer serves fake emoji images, and counts the requests for each path.
+func imageServer(t *testing.T) (*httptest.Server, func(path string) int) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/party.png", "/party-copy.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("party image"))
+		case "/party-v2.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("party image, but better"))
+		case "/login.png":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html>please log in</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[path]
+	}
+}
+
+func TestImageCacheIsContentAddressed(t *testing.T) {
+	b, _ := setupWeekly(t)
+	b.config.CacheImages = true
+	b.config.ImageDownloadWorkers = 3
+	server, requests := imageServer(t)
+	dataUrl := "data:image/gif;base64," + base64.StdEncoding.EncodeToString([]byte("gif image"))
+	response := &SlackEmojiResponseMessage{Emoji: []*Emoji{
+		{Name: "party", Url: server.URL + "/party.png"},
+		{Name: "party-copy", Url: server.URL + "/party-copy.png"},
+		{Name: "deleted-already", Url: server.URL + "/deleted-already.png"},
+		{Name: "login", Url: server.URL + "/login.png"},
+		{Name: "inline", Url: dataUrl},
+		{Name: "fiesta", IsAlias: 1, AliasFor: "party"},
+	}}
+	err := b.cacheEmojiImages(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := b.imageStore()
+	files, err := filepath.Glob(store.dir + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The two party images are the same file, and the failed downloads left nothing behind.
+	if len(files) != 2 {
+		t.Errorf("expected the party and inline images in the cache, got %v", files)
+	}
+	cached, err := b.cachedImagesByUrl()
+	if err != nil {
+		t.Fatal(err)
+	}
+	party, partyCopy := cached[server.URL+"/party.png"], cached[server.URL+"/party-copy.png"]
+	if party == nil || partyCopy == nil || party.Hash != partyCopy.Hash || filepath.Ext(party.File) != ".png" {
+		t.Errorf("unexpected cached party images %+v and %+v", party, partyCopy)
+	}
+	if inline := cached[imageUrlKey(dataUrl)]; inline == nil || inline.ContentType != "image/gif" || filepath.Ext(inline.File) != ".gif" {
+		t.Errorf("unexpected cached data URL image %+v", inline)
+	}
+	if _, ok := cached[server.URL+"/login.png"]; ok {
+		t.Error("a page that is not an image was cached")
+	}
+
+	// party is re-uploaded under the same name.
+	response.Emoji[0].Url = server.URL + "/party-v2.png"
+	err = b.cacheEmojiImages(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests("/party.png") != 1 || requests("/party-copy.png") != 1 {
+		t.Error("images that were cached already were downloaded again")
+	}
+	if requests("/party-v2.png") != 1 || requests("/deleted-already.png") != 2 {
+		t.Error("the re-uploaded image and the failed download were not downloaded")
+	}
+	versions, err := b.imageVersions("party")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Hash != party.Hash || versions[1].Hash == party.Hash {
+		t.Errorf("expected the old and the new image of party, got %+v", versions)
+	}
+	if !fileExists(store.path(party)) {
+		t.Error("the old image of party was lost")
+	}
+}
@@ -0,0 +1,236 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const journalFile = "journal.json"
+
+// runJournal is what a weekly run has posted so far. It is saved after every message, so that when
+// a run fails, the next run resumes it. The steps that were done are run again to rebuild what the
+// later steps need, but nothing that was posted is posted again.
+type runJournal struct {
+	ID       string    `json:"id"`
+	Started  time.Time `json:"started"`
+	Channel  string    `json:"channel"`
+	Finished bool      `json:"finished"`
+	// Where the run started from. A rerun starts from the same place, even though the
+	// channel has the vote prompt of this run by then.
+	Start *runStart      `json:"start,omitempty"`
+	Steps []*journalStep `json:"steps"`
+}
+
+type runStart struct {
+	LastNewEmoji                string `json:"last_new_emoji"`
+	LastNewEmojiCreated         int64  `json:"last_new_emoji_created"`
+	PreviousLastNewEmoji        string `json:"previous_last_new_emoji"`
+	PreviousLastNewEmojiCreated int64  `json:"previous_last_new_emoji_created"`
+	// The vote prompt of last week.
+	VoteChannelID string     `json:"vote_channel_id,omitempty"`
+	VoteMessageTS string     `json:"vote_message_ts,omitempty"`
+	PreviousRun   *runRecord `json:"previous_run,omitempty"`
+}
+
+// journalStep is one report of the run, like the new emojis or the top uploaders.
+type journalStep struct {
+	Name     string            `json:"name"`
+	Done     bool              `json:"done"`
+	Messages []*journalMessage `json:"messages"`
+}
+
+type journalMessage struct {
+	// The channel ID from Slack, which is what editing and deleting the message needs.
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+	Text    string `json:"text"`
+}
+
+func findStep(steps []*journalStep, name string) *journalStep {
+	for _, step := range steps {
+		if step.Name == name {
+			return step
+		}
+	}
+	return nil
+}
+
+func (b *Bot) journalPath() string {
+	return b.dataDir + stateDir + journalFile
+}
+
+// loadJournal returns the journal of the last run, or nil if there is none.
+func (b *Bot) loadJournal() (*runJournal, error) {
+	contents, err := ioutil.ReadFile(b.journalPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	journal := &runJournal{}
+	err = json.Unmarshal(contents, journal)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %v: %w", b.journalPath(), err)
+	}
+	return journal, nil
+}
+
+func (b *Bot) saveJournal() error {
+	err := ensureDirExists(b.dataDir + stateDir)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(b.journalPath(), b.journal)
+}
+
+// recordsRuns is true when the run posts to the channel and is where the next run resumes.
+// Only those runs are journaled.
+func (b *Bot) recordsRuns() bool {
+	return b.config.RunMode == MODE__FULL_SEND && b.reportSince.IsZero() && b.reportUntil.IsZero()
+}
+
+// startJournal starts a new run, resumes the last run if it did not finish, or redoes the last run.
+func (b *Bot) startJournal(redo bool) error {
+	if !b.recordsRuns() {
+		if redo {
+			return errors.New("only full_send runs without --since and --until can be redone")
+		}
+		return nil
+	}
+	last, err := b.loadJournal()
+	if err != nil {
+		return err
+	}
+	switch {
+	case redo:
+		if last == nil {
+			return errors.New("there is no run to redo")
+		}
+		if last.Finished {
+			// The next run should resume from where the redone run started.
+			err = b.removeRun(last.ID)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(b.out, "Redoing run %v, editing the messages that it posted.\n", last.ID)
+		b.redoSteps = last.Steps
+		b.journal = &runJournal{ID: last.ID, Started: b.now(), Channel: b.config.EmojiChannel, Start: last.Start}
+	case last != nil && !last.Finished && last.Channel == b.config.EmojiChannel:
+		fmt.Fprintf(b.out, "Resuming run %v, which did not finish. Messages that it posted are not posted again.\n", last.ID)
+		b.journal = last
+	default:
+		if last != nil && !last.Finished {
+			fmt.Fprintf(b.out, "Run %v did not finish, but it posted to %v. Starting a new run.\n", last.ID, last.Channel)
+		}
+		b.journal = &runJournal{ID: b.now().UTC().Format("20060102T150405.000000000Z"), Started: b.now(), Channel: b.config.EmojiChannel}
+	}
+	return b.saveJournal()
+}
+
+// startRun finds where this run starts from. A resumed or redone run starts where it started the first time.
+func (b *Bot) startRun() error {
+	if b.journal == nil || b.journal.Start == nil {
+		err := b.dealWithLastWeekMessages()
+		if err != nil || b.journal == nil {
+			return err
+		}
+		b.journal.Start = &runStart{
+			LastNewEmoji:                b.lastNewEmoji,
+			LastNewEmojiCreated:         b.lastNewEmojiCreated,
+			PreviousLastNewEmoji:        b.previousLastNewEmoji,
+			PreviousLastNewEmojiCreated: b.previousLastNewEmojiCreated,
+			PreviousRun:                 b.previousRun,
+		}
+		if b.reactionMessage != nil {
+			b.journal.Start.VoteChannelID = b.thisRun.VoteChannelID
+			if b.previousRun != nil {
+				b.journal.Start.VoteChannelID = b.previousRun.VoteChannelID
+			}
+			b.journal.Start.VoteMessageTS = b.reactionMessage.Timestamp
+		}
+		return b.saveJournal()
+	}
+
+	emojiChannelId, err := b.getChannel(b.config.EmojiChannel)
+	if err != nil {
+		return err
+	}
+	start := b.journal.Start
+	b.thisRun = &runRecord{Time: b.journal.Started, VoteChannelID: emojiChannelId}
+	b.previousRun = start.PreviousRun
+	b.lastNewEmoji = start.LastNewEmoji
+	b.lastNewEmojiCreated = start.LastNewEmojiCreated
+	b.previousLastNewEmoji = start.PreviousLastNewEmoji
+	b.previousLastNewEmojiCreated = start.PreviousLastNewEmojiCreated
+	if start.VoteMessageTS != "" {
+		// Fetched again for the votes that came in since.
+		b.reactionMessage, err = b.getVotePrompt(start.VoteChannelID, start.VoteMessageTS)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runStep runs one step of a journaled run. A step that an earlier try of the run finished is run
+// again, since later steps may need what it finds, but it does not post anything.
+func (b *Bot) runStep(name string, run func() error) error {
+	if b.journal == nil {
+		return run()
+	}
+	step := findStep(b.journal.Steps, name)
+	if step == nil {
+		step = &journalStep{Name: name}
+		b.journal.Steps = append(b.journal.Steps, step)
+	}
+	b.currentStep, b.stepMessages = step, 0
+	err := run()
+	b.currentStep = nil
+	if err != nil || step.Done {
+		return err
+	}
+	step.Done = true
+	return b.saveJournal()
+}
+
+func (b *Bot) editMessage(posted *journalMessage, message *renderedMessage) error {
+	_, _, _, err := b.slack.UpdateMessage(posted.Channel, posted.TS, message.msgOptions(b.config.PlainTextMessages)...)
+	if err != nil {
+		return err
+	}
+	posted.Text = message.text
+	return nil
+}
+
+// finishJournal deletes the messages of the redone run that this run did not reuse, and marks the run as finished.
+func (b *Bot) finishJournal() error {
+	if b.journal == nil {
+		return nil
+	}
+	for _, old := range b.redoSteps {
+		reused := 0
+		if step := findStep(b.journal.Steps, old.Name); step != nil {
+			reused = len(step.Messages)
+		}
+		for i := len(old.Messages) - 1; i >= reused; i-- {
+			_, _, err := b.slack.DeleteMessage(old.Messages[i].Channel, old.Messages[i].TS)
+			var slackError slack.SlackErrorResponse
+			if errors.As(err, &slackError) && slackError.Err == "message_not_found" {
+				// Somebody deleted it already.
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	b.redoSteps = nil
+	b.journal.Finished = true
+	return b.saveJournal()
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack/slackevents"
+)
+
+func TestWeeklyResumesAfterFailure(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 2*24*time.Hour)
+	addEmoji(server, "new-two", "U2", 24*time.Hour)
+	// The intro and the emojis are posted, and then posting the vote prompt fails.
+	server.Fail("chat.postMessage", 2, "fatal_error")
+
+	err := b.RunWeekly()
+	if err == nil {
+		t.Fatal("expected the first try to fail")
+	}
+	if posted := postedTo(server, b.config.EmojiChannel); len(posted) != 2 {
+		t.Fatalf("expected 2 messages before the failure, got %v", posted)
+	}
+
+	b.resetRunState()
+	err = b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posted := postedTo(server, b.config.EmojiChannel)
+	seen := map[string]bool{}
+	for _, text := range posted {
+		if seen[text] {
+			t.Errorf("posted twice: %q", text)
+		}
+		seen[text] = true
+	}
+	findPosted(t, posted, votePrompt)
+	state, err := b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Runs) != 1 || state.lastRun().LastNewEmoji != "new-two" {
+		t.Errorf("unexpected saved runs %+v", state.Runs)
+	}
+	journal, err := b.loadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !journal.Finished || journal.ID != state.lastRun().ID {
+		t.Errorf("unexpected journal %+v", journal)
+	}
+}
+
+func TestWeeklyRedoEditsMessages(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 2*24*time.Hour)
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	postedBefore := len(server.Posted())
+	// Uploaded before the run, but the emoji list was slow to show it.
+	addEmoji(server, "new-two", "U2", time.Hour)
+
+	b.resetRunState()
+	err = b.RedoWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.Posted()) != postedBefore {
+		t.Errorf("redo posted %d new messages", len(server.Posted())-postedBefore)
+	}
+	intro := findPosted(t, postedTo(server, b.config.EmojiChannel), "Here are all the new emojis")
+	if !strings.Contains(intro, "There are 2 new emojis") {
+		t.Errorf("the intro was not edited: %q", intro)
+	}
+	state, err := b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Runs) != 1 || state.lastRun().LastNewEmoji != "new-two" {
+		t.Errorf("the redone run should replace the run, got %+v", state.Runs)
+	}
+}
+
+func TestWeeklyRedoNeedsARun(t *testing.T) {
+	b, _ := setupWeekly(t)
+	err := b.RedoWeekly()
+	if err == nil || !strings.Contains(err.Error(), "no run to redo") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestRepliesDuringAStepSkipTheJournal(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 24*time.Hour)
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	postedBefore := postedTo(server, b.config.EmojiChannel)
+
+	// A DM and an emoji_changed event come in on the Socket Mode goroutine while a step is running.
+	b.resetRunState()
+	b.journal, err = b.loadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.runStep(b.journal.Steps[0].Name, func() error {
+		err := b.handleDirectMessage(&slackevents.MessageEvent{ChannelType: "im", Channel: "D1", User: "U1", Text: "mute me"})
+		if err != nil {
+			return err
+		}
+		return b.announceNewEmoji("live-one")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replies := postedTo(server, "D1"); len(replies) != 1 {
+		t.Errorf("expected one reply to the DM, got %v", replies)
+	}
+	posted := postedTo(server, b.config.EmojiChannel)
+	if len(posted) != len(postedBefore)+1 {
+		t.Fatalf("expected only the announcement to be posted, got %v", posted)
+	}
+	for i, text := range postedBefore {
+		if posted[i] != text {
+			t.Errorf("message %d was changed to %q", i, posted[i])
+		}
+	}
+	findPosted(t, posted[len(postedBefore):], "live-one")
+}
@@ -0,0 +1,352 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// The fewest votes that an emoji needs to be one of the top emojis, unless min_votes says otherwise.
+const minReactions = 3
+
+// errNoVoteMessage means that there was no vote prompt to resume from, which happens on the first run.
+var errNoVoteMessage = errors.New("no vote prompt found")
+
+var errMessageNotFound = errors.New("unable to find message")
+
+const firstRunDays = 7
+
+func (b *Bot) dealWithLastWeekMessages() error {
+	// Get the emojis channel
+	emojiChannelId, err := b.getChannel(b.config.EmojiChannel)
+	if err != nil {
+		return err
+	}
+	b.thisRun = &runRecord{Time: b.now(), VoteChannelID: emojiChannelId}
+	if !b.reportSince.IsZero() {
+		// Remaking the report for a window, so there is no vote from the week before.
+		b.lastNewEmojiCreated = b.reportSince.Unix()
+		b.previousLastNewEmojiCreated = b.reportSince.Unix()
+		return nil
+	}
+	if b.config.OverRideLastNewEmoji != "" {
+		// If overriding the last new emoji, assume that we are also not
+		// able to get last week's votes.
+		b.lastNewEmoji = b.config.OverRideLastNewEmoji
+		b.previousLastNewEmoji = b.config.OverRideLastNewEmoji
+		return nil
+	}
+
+	// Resume from the saved state if there is one.
+	state, err := b.loadState()
+	if err != nil {
+		return err
+	}
+	if run := state.lastRun(); run != nil {
+		b.previousRun = run
+		b.lastNewEmoji = run.LastNewEmoji
+		b.lastNewEmojiCreated = run.LastNewEmojiCreated
+		b.previousLastNewEmoji = run.StartEmoji
+		b.previousLastNewEmojiCreated = run.StartEmojiCreated
+		if b.previousLastNewEmoji == "" {
+			b.previousLastNewEmoji = b.lastNewEmoji
+			b.previousLastNewEmojiCreated = b.lastNewEmojiCreated
+		}
+		if run.VoteMessageTS != "" {
+			b.reactionMessage, err = b.getVotePrompt(run.VoteChannelID, run.VoteMessageTS)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Without a saved state, get the two messages that we need from the channel.
+	message, lastEmojiMessage, previousLastEmojiMessage, err := b.findLastWeekMessages(emojiChannelId)
+	if errors.Is(err, errNoVoteMessage) {
+		return b.startFirstRun()
+	} else if err != nil {
+		return err
+	}
+	b.reactionMessage = message
+	// Find the last emoji that was posted last week.
+	parts := strings.Split(lastEmojiMessage.Text, ":")
+	if len(parts) < 2 {
+		return fmt.Errorf("Unable to get last emoji from message %v", lastEmojiMessage)
+	}
+	b.lastNewEmoji = parts[len(parts)-2]
+	parts = strings.Split(previousLastEmojiMessage.Text, ":")
+	if len(parts) < 2 {
+		return fmt.Errorf("Unable to get last emoji from message %v", lastEmojiMessage)
+	}
+	b.previousLastNewEmoji = parts[len(parts)-2]
+	return nil
+}
+
+// startFirstRun makes the emojis from the last week new, since there is nothing to resume from.
+func (b *Bot) startFirstRun() error {
+	fmt.Fprintf(b.out, "No saved state and no vote prompt in %v, so this is the first run. Posting the emojis from the last %d days. "+
+		"Run the init command first to choose a different cutoff.\n", b.config.EmojiChannel, firstRunDays)
+	cutoff := b.now().AddDate(0, 0, -firstRunDays)
+	firstEmoji, err := b.lastEmojiBefore(cutoff)
+	if err != nil {
+		return err
+	}
+	if firstEmoji != nil {
+		b.lastNewEmoji = firstEmoji.Name
+		b.previousLastNewEmoji = firstEmoji.Name
+	}
+	// The cutoff is used instead of the upload time of the emoji, since the
+	// upload times are not known for the emojis from before the bot started.
+	b.lastNewEmojiCreated = cutoff.Unix()
+	b.previousLastNewEmojiCreated = cutoff.Unix()
+	b.reactionMessage = nil
+	return nil
+}
+
+func (b *Bot) findLastWeekMessages(emojiChannelId string) (*slack.Message, *slack.Message, *slack.Message, error) {
+	conversationParams := &slack.GetConversationHistoryParameters{
+		ChannelID: emojiChannelId,
+	}
+	var voteMessage, lastEmojiMessage, previousWeekLastEmojiMessage slack.Message
+	var foundOne, foundTwo, foundThree, foundFour bool
+	// If only one vote prompt was found, this is the second run and both weeks start at the same emoji.
+	notFound := func() (*slack.Message, *slack.Message, *slack.Message, error) {
+		if foundTwo {
+			return &voteMessage, &lastEmojiMessage, &lastEmojiMessage, nil
+		}
+		return nil, nil, nil, errNoVoteMessage
+	}
+	for true {
+		messages, err := b.slack.GetConversationHistory(conversationParams)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if foundOne && !foundTwo {
+			if len(messages.Messages) == 0 {
+				return nil, nil, nil, errors.New("Unable to find message " + b.config.EmojiChannel)
+			}
+			lastEmojiMessage = messages.Messages[0]
+			foundTwo = true
+		}
+		if foundThree && !foundFour {
+			if len(messages.Messages) == 0 {
+				return nil, nil, nil, errors.New("Unable to find message " + b.config.EmojiChannel)
+			}
+			previousWeekLastEmojiMessage = messages.Messages[0]
+			foundFour = true
+			break
+		}
+		for i, message := range messages.Messages {
+			if message.Text == votePrompt || message.Text == votePromptPrevious {
+				if !foundOne {
+					voteMessage = message
+					foundOne = true
+					if len(messages.Messages) > i+1 {
+						lastEmojiMessage = messages.Messages[i+1]
+						foundTwo = true
+					}
+				} else {
+					foundThree = true
+					if len(messages.Messages) > i+1 {
+						previousWeekLastEmojiMessage = messages.Messages[i+1]
+						foundFour = true
+						break
+					}
+				}
+			}
+		}
+		if foundFour {
+			break
+		}
+		if len(messages.ResponseMetaData.NextCursor) == 0 {
+			return notFound()
+		}
+		// Check if we have looked through 15 days
+		lastMessageTime, err := timeFromMessage(&messages.Messages[len(messages.Messages)-1])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if b.since(lastMessageTime) > time.Hour*24*16 {
+			return notFound()
+		}
+		conversationParams.Cursor = messages.ResponseMetaData.NextCursor
+	}
+	return &voteMessage, &lastEmojiMessage, &previousWeekLastEmojiMessage, nil
+}
+
+// getMessage gets a single message by its timestamp.
+func (b *Bot) getMessage(channelId, timestamp string) (*slack.Message, error) {
+	messages, err := b.slack.GetConversationHistory(&slack.GetConversationHistoryParameters{
+		ChannelID: channelId,
+		Latest:    timestamp,
+		Oldest:    timestamp,
+		Inclusive: true,
+		Limit:     1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(messages.Messages) == 0 {
+		return nil, fmt.Errorf("%w %v in channel %v", errMessageNotFound, timestamp, channelId)
+	}
+	return &messages.Messages[0], nil
+}
+
+// getVotePrompt gets last week's vote prompt. If somebody deleted it, the run goes on without last week's
+// votes, and the prompt is nil.
+func (b *Bot) getVotePrompt(channelId, timestamp string) (*slack.Message, error) {
+	message, err := b.getMessage(channelId, timestamp)
+	if errors.Is(err, errMessageNotFound) {
+		fmt.Fprintf(b.out, "Last week's vote prompt %v is gone, so its votes are not counted: %v\n", timestamp, err)
+		return nil, nil
+	}
+	return message, err
+}
+
+// lastRunTime is when the previous weekly run happened.
+func (b *Bot) lastRunTime() time.Time {
+	if b.previousRun != nil {
+		return b.previousRun.Time
+	}
+	if b.reactionMessage != nil {
+		lastRun, err := timeFromMessage(b.reactionMessage)
+		if err == nil {
+			return lastRun
+		}
+	}
+	return b.now().AddDate(0, 0, -7)
+}
+
+func timeFromMessage(message *slack.Message) (time.Time, error) {
+	seconds, err := strconv.ParseFloat(message.Timestamp, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(float64(time.Second)*seconds)), nil
+}
+
+func (b *Bot) getChannel(channelName string) (string, error) {
+	if len(channelName) == 0 {
+		return "", errors.New("No channel name provided")
+	}
+	if b.channelID != "" {
+		return b.channelID, nil
+	}
+	if channelName[0] == '#' {
+		channelName = channelName[1:]
+	}
+	channelsParams := &slack.GetConversationsParameters{
+		ExcludeArchived: true,
+		Limit:           1000,
+		TeamID:          b.config.TeamId,
+	}
+	var emojiChannelData slack.Channel
+	for true {
+		channels, cursor, err := b.slack.GetConversations(channelsParams)
+		if err != nil {
+			return "", err
+		}
+		var found bool
+		for _, channel := range channels {
+			if channel.IsChannel && channel.Name == channelName {
+				found = true
+				emojiChannelData = channel
+				break
+			}
+		}
+		if found {
+			break
+		}
+		if cursor == "" {
+			return "", errors.New("Unable to find channel " + b.config.EmojiChannel)
+		}
+		channelsParams.Cursor = cursor
+	}
+	fmt.Fprintf(b.out, "Found Channel ID: %v. You can set this as cached_channel_id in the config file for faster run times.\n", emojiChannelData.ID)
+	b.channelID = emojiChannelData.ID
+	return emojiChannelData.ID, nil
+}
+
+// printTopEmojisByReactionVote prints the emojis with the most votes. wrappedYear is 0 for the weekly vote,
+// or the year being summarized by Emojis Wrapped. Votes for an alias count for the emoji it is for, and are
+// credited to whoever uploaded that emoji.
+func (b *Bot) printTopEmojisByReactionVote(allEmojis *SlackEmojiResponseMessage, wrappedYear int, maxPrintCount int, messages ...*slack.Message) error {
+	resolver := b.emojiResolver(allEmojis)
+	err := b.recordVotePrompts(resolver, messages)
+	if err != nil {
+		return err
+	}
+	counted, err := b.countVotes(resolver, wrappedYear, messages)
+	if err != nil {
+		return err
+	}
+	err = b.printExcludedVotes(counted.excluded)
+	if err != nil {
+		return err
+	}
+	err = b.printUnorderedVotes(counted)
+	if err != nil {
+		return err
+	}
+	voterCount := counted.voters
+
+	if !b.emojiSource.HasUploaders() {
+		return b.printTopEmojis(wrappedYear, maxPrintCount, counted.emojis, voterCount)
+	}
+
+	printed, ranks := b.topVotedEmojis(counted.emojis, maxPrintCount, true)
+	var creators []string
+	var counts []string
+	var printedEmojis []string
+	for _, emoji := range printed {
+		creators = append(creators, emoji.uploader)
+		counts = append(counts, b.formatVotes(emoji))
+		var name string
+		if b.config.AprilFoolsMode {
+			name = b.config.AprilFoolsEmoji
+		} else {
+			name = emoji.name
+		}
+		printedEmojis = append(printedEmojis, name)
+	}
+	var notes []string
+	if b.config.NoteAliasCreators && !b.config.AprilFoolsMode {
+		notes, err = b.aliasNotes(printed)
+		if err != nil {
+			return err
+		}
+	}
+
+	peopleToPrint := TopPeopleToPrint
+	message := fmt.Sprintf(lastWeek, voterCount)
+	if wrappedYear != 0 {
+		peopleToPrint = 20
+		message = fmt.Sprintf(lastYear, wrappedYear, voterCount)
+	}
+
+	return b.printTopCreators(message, peopleToPrint, ranks, creators, counts, printedEmojis, notes)
+}
+
+// printTopEmojis prints the emojis with the most votes, without who uploaded them.
+func (b *Bot) printTopEmojis(wrappedYear int, maxPrintCount int, emojis []*emojiVoteCount, voterCount int) error {
+	message := fmt.Sprintf(lastWeek, voterCount)
+	if wrappedYear != 0 {
+		message = fmt.Sprintf(lastYear, wrappedYear, voterCount)
+	}
+	var lines []string
+	printed, ranks := b.topVotedEmojis(emojis, maxPrintCount, false)
+	for i, emoji := range printed {
+		name := emoji.name
+		if b.config.AprilFoolsMode {
+			name = b.config.AprilFoolsEmoji
+		}
+		lines = append(lines, b.printer.Sprintf("%d. :%s: %s", ranks[i], name, b.formatVotes(emoji)))
+	}
+	_, err := b.printMessages(MSG_TYPE__SEND_AND_REVIEW, renderLeaderboard(message, lines), "")
+	return err
+}
@@ -1,36 +1,27 @@
-package main
+package bot
 
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
-	"strconv"
-	"strings"
-)
-
-const (
-	emojiListUrl = "https://square.slack.com/api/emoji.adminList"
-)
+	"time"
 
-var (
-	pageSize = 10000
+	"github.com/slack-go/slack"
 )
 
-func init() {
-	if fastMode {
-		pageSize = 1000
+func (b *Bot) pageSize() int {
+	if b.config.FastMode {
+		return 1000
 	}
+	return 10000
 }
 
 type SlackEmojiResponseMessage struct {
 	Ok                    bool           `json:"ok"`
 	Error                 string         `json:"error"`
-	Emoji                 []*emoji       `json:"emoji"`
+	Emoji                 []*Emoji       `json:"emoji"`
 	CustomEmojiTotalCount int64          `json:"custom_emoji_total_count"`
 	Paging                PagingResponse `json:"paging"`
-	emojiMap              map[string]*emoji
+	emojiMap              map[string]*Emoji
 	peopleThisWeek        map[string]*stringCount
 }
 
@@ -41,7 +32,7 @@ type PagingResponse struct {
 	Pages int `json:"pages"`
 }
 
-type emoji struct {
+type Emoji struct {
 	Name            string
 	IsAlias         int    `json:"is_alias"`
 	AliasFor        string `json:"alias_for"`
@@ -52,15 +43,12 @@ type emoji struct {
 	UserDisplayName string `json:"user_display_name"`
 }
 
-func getAllEmojis() (*SlackEmojiResponseMessage, error) {
+func (b *Bot) getAllEmojis() (*SlackEmojiResponseMessage, error) {
 	var allEmojis, currentPage *SlackEmojiResponseMessage
 	for page := 1; currentPage == nil || page <= currentPage.Paging.Pages; page++ {
-		fmt.Printf("Getting page %v\n", page)
-		commandResponse, err := getEmojis(page)
-		if err != nil {
-			return nil, err
-		}
-		currentPage, err = parseEmojiResponse(commandResponse)
+		fmt.Fprintf(b.out, "Getting page %v\n", page)
+		var err error
+		currentPage, err = b.emojiSource.GetPage(page, b.pageSize())
 		if err != nil {
 			return nil, err
 		}
@@ -70,29 +58,40 @@ func getAllEmojis() (*SlackEmojiResponseMessage, error) {
 			allEmojis.Emoji = append(allEmojis.Emoji, currentPage.Emoji...)
 		}
 	}
-	if cacheEmojiDumps {
-		err := cacheEmojiResponse(allEmojis)
+	if b.config.CacheEmojiDumps {
+		err := b.cacheEmojiResponse(allEmojis)
 		if err != nil {
 			return nil, err
 		}
 	}
+	err := b.recordSeenEmojis(allEmojis.Emoji, true)
+	if err != nil {
+		return nil, err
+	}
 
-	allEmojis.emojiMap = make(map[string]*emoji, len(allEmojis.Emoji))
+	allEmojis.emojiMap = make(map[string]*Emoji, len(allEmojis.Emoji))
 	for i, emoji := range allEmojis.Emoji {
 		allEmojis.emojiMap[emoji.Name] = allEmojis.Emoji[i]
 	}
 	return allEmojis, nil
 }
 
-func getEmojisBackTo(lastEmoji string) (*SlackEmojiResponseMessage, error) {
+// allEmojis gets every emoji. In fast mode, the emojis that were seen before are read from the history.
+func (b *Bot) allEmojis() (*SlackEmojiResponseMessage, error) {
+	if b.config.FastMode {
+		return b.getAllEmojisFromHistory()
+	}
+	return b.getAllEmojis()
+}
+
+// getEmojisBackTo gets the emojis newer than the given emoji. When the upload time of the emoji is known,
+// the pages stop at that time, so this also works if the emoji was deleted or renamed.
+func (b *Bot) getEmojisBackTo(lastEmoji string, lastEmojiCreated int64) (*SlackEmojiResponseMessage, error) {
 	var allEmojis, currentPage *SlackEmojiResponseMessage
 	for page := 1; currentPage == nil || page <= currentPage.Paging.Pages; page++ {
-		fmt.Printf("Getting page %v\n", page)
-		commandResponse, err := getEmojis(page)
-		if err != nil {
-			return nil, err
-		}
-		currentPage, err = parseEmojiResponse(commandResponse)
+		fmt.Fprintf(b.out, "Getting page %v\n", page)
+		var err error
+		currentPage, err = b.emojiSource.GetPage(page, b.pageSize())
 		if err != nil {
 			return nil, err
 		}
@@ -103,7 +102,7 @@ func getEmojisBackTo(lastEmoji string) (*SlackEmojiResponseMessage, error) {
 		}
 		stop := false
 		for _, emoji := range currentPage.Emoji {
-			if emoji.Name == lastEmoji {
+			if emoji.Name == lastEmoji || int64(emoji.Created) <= lastEmojiCreated {
 				stop = true
 			}
 		}
@@ -111,44 +110,42 @@ func getEmojisBackTo(lastEmoji string) (*SlackEmojiResponseMessage, error) {
 			break
 		}
 	}
-	if cacheEmojiDumps {
-		err := cacheEmojiResponse(allEmojis)
+	if b.config.CacheEmojiDumps {
+		err := b.cacheEmojiResponse(allEmojis)
 		if err != nil {
 			return nil, err
 		}
 	}
+	err := b.recordSeenEmojis(allEmojis.Emoji, false)
+	if err != nil {
+		return nil, err
+	}
 
-	allEmojis.emojiMap = make(map[string]*emoji, len(allEmojis.Emoji))
+	allEmojis.emojiMap = make(map[string]*Emoji, len(allEmojis.Emoji))
 	for i, emoji := range allEmojis.Emoji {
 		allEmojis.emojiMap[emoji.Name] = allEmojis.Emoji[i]
 	}
 	return allEmojis, nil
 }
 
-func getEmojis(page int) ([]byte, error) {
-	vals := url.Values{}
-	vals.Set("token", ownerUserOauthToken)
-	vals.Set("page", strconv.Itoa(page))
-	vals.Set("count", strconv.Itoa(pageSize))
-	vals.Set("sort_by", "created")
-	vals.Set("sort_dir", "desc")
-	vals.Set("_x_mode", "online")
-
-	req, err := http.NewRequest("POST", emojiListUrl, strings.NewReader(vals.Encode()))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("cookie", ownerUserCookie)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+// lastEmojiBefore returns the newest emoji that was uploaded before the given time, or nil if there is none.
+func (b *Bot) lastEmojiBefore(cutoff time.Time) (*Emoji, error) {
+	var currentPage *SlackEmojiResponseMessage
+	for page := 1; currentPage == nil || page <= currentPage.Paging.Pages; page++ {
+		fmt.Fprintf(b.out, "Getting page %v\n", page)
+		var err error
+		currentPage, err = b.emojiSource.GetPage(page, b.pageSize())
+		if err != nil {
+			return nil, err
+		}
+		// The emojis are sorted by upload date, newest first.
+		for _, emoji := range currentPage.Emoji {
+			if int64(emoji.Created) < cutoff.Unix() {
+				return emoji, nil
+			}
+		}
 	}
-	return bodyBytes, nil
+	return nil, nil
 }
 
 func parseEmojiResponse(response []byte) (responseParsed *SlackEmojiResponseMessage, err error) {
@@ -159,13 +156,12 @@ func parseEmojiResponse(response []byte) (responseParsed *SlackEmojiResponseMess
 	}()
 	//fmt.Printf("Parsing response: %v\n", string(response))
 	responseParsed = &SlackEmojiResponseMessage{}
-	responseParsed.Emoji = make([]*emoji, 0, pageSize)
 	err = json.Unmarshal(response, responseParsed)
 	if err != nil {
 		return nil, err
 	}
 	if !responseParsed.Ok {
-		return nil, fmt.Errorf("recieved error from Slack: %v", responseParsed.Error)
+		return nil, fmt.Errorf("recieved error from Slack: %w", slack.SlackErrorResponse{Err: responseParsed.Error})
 	}
 	return responseParsed, nil
 }
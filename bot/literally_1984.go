@@ -1,4 +1,4 @@
-package main
+package bot
 
 import (
 	"sort"
@@ -7,32 +7,33 @@ import (
 	"github.com/ryho/slack-emoji-bot/util"
 )
 
-func removeSkippedEmojis(response *SlackEmojiResponseMessage) {
-	// Remove colons. This allows the emojis to be specified as
-	// :emoji_name: or just emoji_name
-	for emoji := range skipEmojis {
-		if emoji[0] == ':' {
-			skipEmojis[strings.ReplaceAll(emoji, ":", "")] = util.SetEntry{}
-			delete(skipEmojis, emoji)
-		}
+func (b *Bot) removeSkippedEmojis(response *SlackEmojiResponseMessage) error {
+	prefs, err := b.loadPreferences()
+	if err != nil {
+		return err
 	}
 	uniqueNames := util.StringSet{}
 
 	sort.Sort(EmojiUploadDateSortBackwards(response.Emoji))
-	var newEmojiList []*emoji
+	var newEmojiList []*Emoji
 	for i := 0; i < len(response.Emoji); i++ {
 		emoji := response.Emoji[i]
-		if literally1984Mode {
-			if _, ok := skipEmojis[emoji.Name]; ok {
+		if b.config.Literally1984Mode {
+			if _, ok := b.config.SkipEmojis[emoji.Name]; ok {
 				delete(response.emojiMap, emoji.Name)
 				continue
 			}
 		}
-		if skipScreenShots && strings.HasPrefix(emoji.Name, "screen-shot-") {
+		// Reviewers skip emojis when they edit the skip list of a preview.
+		if _, ok := prefs.SkippedEmojis[emoji.Name]; ok {
+			delete(response.emojiMap, emoji.Name)
+			continue
+		}
+		if b.config.SkipScreenShots && strings.HasPrefix(emoji.Name, "screen-shot-") {
 			delete(response.emojiMap, emoji.Name)
 			continue
 		}
-		if skipDuplicateBulkImportEmojis {
+		if b.config.SkipDuplicateBulkImportEmojis {
 			// If this is turned on, emojis in the format "emoji-name-123" will be skipped.
 			// This is the format used by Slack if another work space's emojis are merged in and there are duplicate names.
 			lastOccurrence := strings.LastIndex(emoji.Name, "-")
@@ -45,7 +46,7 @@ func removeSkippedEmojis(response *SlackEmojiResponseMessage) {
 			}
 		}
 		// Do not include emojis if after removing - and _ they are a dupe of an existing emoji.
-		if strictUniqueMode {
+		if b.config.StrictUniqueMode {
 			cleanName := strings.ReplaceAll(strings.ReplaceAll(strings.ToLower(emoji.Name), "-", ""), "_", "")
 			if _, ok := uniqueNames[cleanName]; ok {
 				delete(response.emojiMap, emoji.Name)
@@ -56,6 +57,7 @@ func removeSkippedEmojis(response *SlackEmojiResponseMessage) {
 		newEmojiList = append(newEmojiList, emoji)
 	}
 	response.Emoji = newEmojiList
+	return nil
 }
 
 func onlyNumbers(input string) bool {
@@ -0,0 +1,34 @@
+package bot
+
+import "sort"
+
+type StringLengthSort []*Emoji
+
+func (p StringLengthSort) Len() int           { return len(p) }
+func (p StringLengthSort) Less(i, j int) bool { return len(p[i].Name) > len(p[j].Name) }
+func (p StringLengthSort) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// RunLongest prints the longest emoji names.
+func (b *Bot) RunLongest() error {
+	return b.report("longest", func() error {
+		allEmojis, err := b.allEmojis()
+		if err != nil {
+			return err
+		}
+		err = b.removeSkippedEmojis(allEmojis)
+		if err != nil {
+			return err
+		}
+		return b.longestEmojis(allEmojis)
+	})
+}
+
+func (b *Bot) longestEmojis(response *SlackEmojiResponseMessage) error {
+	sort.Sort(StringLengthSort(response.Emoji))
+	message := "Longest Emoji Names:\n"
+	for i := 0; i < maxEmojisForLongestEmojis && i < len(response.Emoji); i++ {
+		message += b.printer.Sprintf("%d. :%s: %s (%d)\n", i+1, response.Emoji[i].Name, response.Emoji[i].Name, len(response.Emoji[i].Name))
+	}
+	_, err := b.printMessage(MSG_TYPE__PRINT_ONLY, message)
+	return err
+}
@@ -0,0 +1,37 @@
+package bot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLongestEmojisPrintsToOutput(t *testing.T) {
+	config := DefaultConfig()
+	config.OwnerLDAP = "owner"
+	config.OwnerUserId = "UOWNER"
+	config.BotOauthToken = "xoxb-test"
+	config.EmojiSource = EMOJI_SOURCE__EMOJI_LIST
+	var out bytes.Buffer
+	b, err := New(config, WithOutput(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.longestEmojis(&SlackEmojiResponseMessage{Emoji: []*Emoji{
+		{Name: "short"},
+		{Name: "a-much-longer-name"},
+		{Name: "medium-name"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Longest Emoji Names:\n" +
+		"1. :a-much-longer-name: a-much-longer-name (18)\n" +
+		"2. :medium-name: medium-name (11)\n" +
+		"3. :short: short (5)\n"
+	if got := strings.TrimSpace(out.String()); got != strings.TrimSpace(want) {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package bot
 
 import (
 	"math/rand"
@@ -6,27 +6,24 @@ import (
 )
 
 type EmojiMeme struct {
-	EmojiName string
+	EmojiName string `json:"emoji_name"`
 
-	SubStrings  []string
-	StartEmoji  string
-	NoNewEmojis string
+	SubStrings  []string `json:"sub_strings"`
+	StartEmoji  string   `json:"start_emoji"`
+	NoNewEmojis string   `json:"no_new_emojis"`
 }
 
-func memeCounter(response *SlackEmojiResponseMessage) error {
-	if len(EmojiMemes) == 0 {
+func (b *Bot) memeCounter(response *SlackEmojiResponseMessage) error {
+	if len(b.config.EmojiMemes) == 0 {
 		return nil
 	}
 
-	lastNewEmojiSanitized := strings.ReplaceAll(lastNewEmoji, ":", "")
-	newMemeEmojis := make([][]string, len(EmojiMemes))
+	newMemeEmojis := make([][]string, len(b.config.EmojiMemes))
 
 	// Find all emojis that are part of the given meme type
-	for _, emoji := range response.Emoji {
-		if emoji.Name == lastNewEmojiSanitized {
-			break
-		}
-		for i, meme := range EmojiMemes {
+	newEmojiList, _ := b.newEmojis(response)
+	for _, emoji := range newEmojiList {
+		for i, meme := range b.config.EmojiMemes {
 			for _, subString := range meme.SubStrings {
 				if strings.Contains(emoji.Name, subString) {
 					newMemeEmojis[i] = append(newMemeEmojis[i], emoji.Name)
@@ -36,9 +33,9 @@ func memeCounter(response *SlackEmojiResponseMessage) error {
 		}
 	}
 	// Choose a start emoji from the emoji type with the most new emojis
-	startEmoji := genericSadEmoji
+	startEmoji := b.config.GenericSadEmoji
 	var maxNewEmojis int
-	for i, emojiMeme := range EmojiMemes {
+	for i, emojiMeme := range b.config.EmojiMemes {
 		if len(newMemeEmojis[i]) > maxNewEmojis {
 			maxNewEmojis = len(newMemeEmojis[i])
 			startEmoji = emojiMeme.StartEmoji
@@ -47,7 +44,7 @@ func memeCounter(response *SlackEmojiResponseMessage) error {
 
 	// Choose random emojis for the meme types
 	var randomMemeEmojis []string
-	for i, emojiMeme := range EmojiMemes {
+	for i, emojiMeme := range b.config.EmojiMemes {
 		if len(newMemeEmojis[i]) == 0 {
 			randomMemeEmojis = append(randomMemeEmojis, emojiMeme.NoNewEmojis)
 		} else {
@@ -56,13 +53,13 @@ func memeCounter(response *SlackEmojiResponseMessage) error {
 	}
 
 	var messages []string
-	for i, emojiMeme := range EmojiMemes {
-		messages = append(messages, printer.Sprintf("%d new *%s* emojis :%s:", len(newMemeEmojis[i]), emojiMeme.EmojiName, randomMemeEmojis[i]))
+	for i, emojiMeme := range b.config.EmojiMemes {
+		messages = append(messages, b.printer.Sprintf("%d new *%s* emojis :%s:", len(newMemeEmojis[i]), emojiMeme.EmojiName, randomMemeEmojis[i]))
 	}
 	messages[len(messages)-1] = "and " + messages[len(messages)-1]
 
-	_, err := printMessage(MSG_TYPE__SEND_AND_REVIEW,
-		printer.Sprintf(":%s: There are %s this week!",
+	_, err := b.printMessage(MSG_TYPE__SEND_AND_REVIEW,
+		b.printer.Sprintf(":%s: There are %s this week!",
 			startEmoji, strings.Join(messages, ", ")))
 	return err
 }
@@ -0,0 +1,272 @@
+package bot
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+func (b *Bot) getUsers(userIds []string) (map[string]*slack.User, error) {
+	users := map[string]*slack.User{}
+	var endIndex int
+	// This endpoint only supports 100 users per request, so we need to request them in batches.
+	for startIndex := 0; startIndex < len(userIds); startIndex = endIndex {
+		endIndex = minInt(startIndex+30, len(userIds))
+		batchUserIds := userIds[startIndex:endIndex]
+		usersResults, err := b.slack.GetUsersInfo(batchUserIds...)
+		if err != nil {
+			return nil, err
+		}
+		for i, user := range *usersResults {
+			users[user.ID] = &(*usersResults)[i]
+		}
+	}
+	return users, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func createNameString(peopleArray []string) string {
+	if len(peopleArray) == 0 {
+		return ""
+	} else if len(peopleArray) == 1 {
+		return "Thanks to " + peopleArray[0] + "."
+	}
+	sort.Strings(peopleArray)
+	return "Thanks to " + strings.Join(peopleArray[:len(peopleArray)-1], ", ") + ", and " + peopleArray[len(peopleArray)-1] + "."
+}
+
+func countUploaders(emojis []*Emoji) map[string]*stringCount {
+	people := map[string]*stringCount{}
+	for _, emoji := range emojis {
+		count, ok := people[emoji.UserId]
+		if !ok {
+			people[emoji.UserId] = &stringCount{
+				name:  emoji.UserDisplayName,
+				id:    emoji.UserId,
+				count: 1,
+			}
+		} else {
+			count.count++
+		}
+	}
+	return people
+}
+
+func (b *Bot) topAndNewUploaders(response *SlackEmojiResponseMessage) error {
+	if !b.emojiSource.HasUploaders() {
+		fmt.Fprintln(b.out, "Skipping the top uploaders, the emoji source does not have uploaders.")
+		return nil
+	}
+	people := countUploaders(response.Emoji)
+	_, err := b.printer.Fprintf(b.out, "%d people have uploaded %d emojis\n", len(people), len(response.Emoji))
+	if err != nil {
+		return err
+	}
+	err = b.printTopPeople(topAllTimeMessage, topSecondMessage, people, maxPeopleForTopUploaders, !b.config.SendTopUploadersAllTime)
+	if err != nil {
+		return err
+	}
+
+	if b.config.FastMode {
+		// The new uploaders feature doesn't work in fast mode.
+		return nil
+	}
+
+	// Find people who uploaded for the first time.
+	newPeopleThisWeek := map[string]*stringCount{}
+	for _, uploadThisWeek := range response.peopleThisWeek {
+		if uploadsAllTime, ok := people[uploadThisWeek.id]; !ok || uploadThisWeek.count == uploadsAllTime.count {
+			newPeopleThisWeek[uploadThisWeek.id] = uploadThisWeek
+		}
+	}
+	newUploadersMessage := fmt.Sprintf(newUploadersMessage, len(newPeopleThisWeek))
+	err = b.printTopPeople(newUploadersMessage, newUploadersSecondMessage, newPeopleThisWeek, maxPeopleForTopUploaders, false)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RunTopUploaders posts the top emoji uploaders of the week, or of all time.
+func (b *Bot) RunTopUploaders(allTime bool) error {
+	return b.report("top_uploaders", func() error {
+		if !b.emojiSource.HasUploaders() {
+			return fmt.Errorf("the %v emoji source does not have uploaders, use admin_list for top uploaders", b.config.EmojiSource)
+		}
+		if allTime {
+			allEmojis, err := b.allEmojis()
+			if err != nil {
+				return err
+			}
+			err = b.removeSkippedEmojis(allEmojis)
+			if err != nil {
+				return err
+			}
+			return b.printTopPeople(topAllTimeMessage, topSecondMessage, countUploaders(allEmojis.Emoji), maxPeopleForTopUploaders, false)
+		}
+
+		err := b.dealWithLastWeekMessages()
+		if err != nil {
+			return err
+		}
+		var allEmojis *SlackEmojiResponseMessage
+		if b.config.FastMode {
+			allEmojis, err = b.getEmojisBackTo(b.lastNewEmoji, b.lastNewEmojiCreated)
+		} else {
+			allEmojis, err = b.allEmojis()
+		}
+		if err != nil {
+			return err
+		}
+		err = b.removeSkippedEmojis(allEmojis)
+		if err != nil {
+			return err
+		}
+		newEmojiList, _ := b.newEmojis(allEmojis)
+		return b.printTopPeople(topThisWeekMessage, topSecondMessage, countUploaders(newEmojiList), math.MaxInt64, false)
+	})
+}
+
+func (b *Bot) printTopPeople(firstMessage, secondMessage string, people map[string]*stringCount, maxPeople int, printOnly bool) error {
+	var peopleCountArray []*stringCount
+	for _, count := range people {
+		peopleCountArray = append(peopleCountArray, count)
+	}
+	sort.Sort(ByCount(peopleCountArray))
+	var firstLines, secondLines []string
+	var peopleIds []string
+	for i := 0; i < maxPeople && i < len(peopleCountArray); i++ {
+		peopleIds = append(peopleIds, peopleCountArray[i].id)
+	}
+	userMap, err := b.getUsers(peopleIds)
+	if err != nil {
+		return err
+	}
+	prefs, err := b.loadPreferences()
+	if err != nil {
+		return err
+	}
+	var skipCorrection int
+	for i := 0; i < maxPeople && i < len(peopleCountArray); i++ {
+		user, ok := userMap[peopleCountArray[i].id]
+		if !ok {
+			return fmt.Errorf("could not find user %v %v", peopleCountArray[i].id, peopleCountArray[i].name)
+		}
+		if prefs.isSkipped(user) {
+			// This skips the user so they do not show up at all.
+			skipCorrection++
+			continue
+		}
+		if prefs.isMuted(user) {
+			// This prints the LDAP with no @ sign, so they will not be pinged.
+			if i < TopPeopleToPrint {
+				firstLines = append(firstLines, b.printer.Sprintf("%d. %s (%s) %d", i+1-skipCorrection, peopleCountArray[i].name, user.Name, peopleCountArray[i].count))
+			} else {
+				secondLines = append(secondLines, b.printer.Sprintf("%d. %s (%s) %d", i+1-skipCorrection, peopleCountArray[i].name, user.Name, peopleCountArray[i].count))
+			}
+		} else {
+			if i < TopPeopleToPrint {
+				firstLines = append(firstLines, b.printer.Sprintf("%d. %s (%s) %d", i+1-skipCorrection, peopleCountArray[i].name, b.mention(user, printOnly), peopleCountArray[i].count))
+			} else {
+				secondLines = append(secondLines, b.printer.Sprintf("%d. %s (%s) %d", i+1-skipCorrection, peopleCountArray[i].name, b.mention(user, printOnly), peopleCountArray[i].count))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	level := MSG_TYPE__SEND
+	if printOnly {
+		level = MSG_TYPE__PRINT_ONLY
+	}
+	threadId, err := b.printMessages(level, renderLeaderboard(firstMessage, firstLines), "")
+	if err != nil {
+		return err
+	}
+	muteText, skipText := b.muteAndSkipMessages()
+	_, err = b.printMessages(level, renderLeaderboard(secondMessage, secondLines, muteText, skipText), threadId)
+	return err
+}
+
+// mention names a person in a leaderboard. Messages that are sent to the API use the API format, which pings
+// them, and the rest say @name. Interactive previews have both, since the DM says @name, and the preview is
+// posted with the API format when it is approved. See printableMentions and postableMentions.
+func (b *Bot) mention(user *slack.User, printOnly bool) string {
+	if printOnly || b.config.RunMode == MODE__PRINT_EVERYTHING {
+		return "@" + user.Name
+	}
+	if b.reviewsInteractively() {
+		return fmt.Sprintf("<@%s|%s>", user.ID, user.Name)
+	}
+	if b.config.RunMode == MODE__DM_FOR_REVIEW {
+		return "@" + user.Name
+	}
+	return fmt.Sprintf("<@%s>", user.ID)
+}
+
+// muteAndSkipMessages explains how to get on the mute and skip lists. When the serve command is
+// listening over Socket Mode, people can do it themselves by messaging the bot.
+func (b *Bot) muteAndSkipMessages() (string, string) {
+	if b.config.AppToken != "" {
+		return muteMessageSelfService, skipMessageSelfService
+	}
+	return fmt.Sprintf(muteMessage, b.config.OwnerLDAP), fmt.Sprintf(skipMessage, b.config.OwnerLDAP)
+}
+
+// printTopCreators prints the uploaders of the top emojis, numbered by ranks. notes are added after the count
+// of each emoji, or can be nil.
+func (b *Bot) printTopCreators(message string, TopPeopleToPrint int, ranks []int, peopleIds []string, reactions []string, emojis []string, notes []string) error {
+	var firstLines, secondLines []string
+	userMap, err := b.getUsers(peopleIds)
+	if err != nil {
+		return err
+	}
+	prefs, err := b.loadPreferences()
+	if err != nil {
+		return err
+	}
+	for i, peopleId := range peopleIds {
+		user, ok := userMap[peopleId]
+		if !ok {
+			return fmt.Errorf("could not find user %v", peopleId)
+		}
+		if prefs.isSkipped(user) {
+			continue
+		}
+		var note string
+		if notes != nil {
+			note = notes[i]
+		}
+		if prefs.isMuted(user) {
+			// This prints the LDAP with no @ sign, so they will not be pinged.
+			if i < TopPeopleToPrint {
+				firstLines = append(firstLines, b.printer.Sprintf("%d. %s (%s) :%s: %s%s", ranks[i], user.RealName, user.Name, emojis[i], reactions[i], note))
+			} else {
+				secondLines = append(secondLines, b.printer.Sprintf("%d. %s (%s) :%s: %s%s", ranks[i], user.RealName, user.Name, emojis[i], reactions[i], note))
+			}
+		} else {
+			if i < TopPeopleToPrint {
+				firstLines = append(firstLines, b.printer.Sprintf("%d. %s (%s) :%s: %s%s", ranks[i], user.RealName, b.mention(user, false), emojis[i], reactions[i], note))
+			} else {
+				secondLines = append(secondLines, b.printer.Sprintf("%d. %s (%s) :%s: %s%s", ranks[i], user.RealName, b.mention(user, false), emojis[i], reactions[i], note))
+			}
+		}
+	}
+	threadId, err := b.printMessages(MSG_TYPE__SEND_AND_REVIEW, renderLeaderboard(message, firstLines), "")
+	if err != nil {
+		return err
+	}
+	muteText, skipText := b.muteAndSkipMessages()
+	_, err = b.printMessages(MSG_TYPE__SEND_AND_REVIEW, renderLeaderboard(moreTopCreatorsMessage, secondLines, muteText, skipText), threadId)
+	return err
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/slack-go/slack/slackevents"
+)
+
+const voteReactionsFile = "voteReactions.jsonl"
+
+// voteReaction is a reaction_added or reaction_removed event on a vote prompt, as it is saved in the local
+// history. Slack does not say in which order someone reacted to a message, so ranked_choice uses these.
+type voteReaction struct {
+	Time time.Time `json:"time"`
+	// The timestamp of the vote prompt.
+	MessageTS string `json:"message_ts"`
+	User      string `json:"user"`
+	Reaction  string `json:"reaction"`
+	Removed   bool   `json:"removed,omitempty"`
+}
+
+// handleReaction saves the reactions on the vote prompts. Reactions on other messages are ignored. A
+// reaction_removed event is the same as a reaction_added event, with removed set.
+func (b *Bot) handleReaction(event *slackevents.ReactionAddedEvent, removed bool) error {
+	if event.Item.Type != "message" {
+		return nil
+	}
+	state, err := b.loadState()
+	if err != nil {
+		return err
+	}
+	isVotePrompt := false
+	for _, run := range state.Runs {
+		if run.VoteChannelID == event.Item.Channel && run.VoteMessageTS == event.Item.Timestamp {
+			isVotePrompt = true
+		}
+	}
+	if !isVotePrompt {
+		return nil
+	}
+	return b.recordVoteReaction(&voteReaction{
+		Time:      eventTime(json.Number(event.EventTimestamp), b.now()),
+		MessageTS: event.Item.Timestamp,
+		User:      event.User,
+		Reaction:  event.Reaction,
+		Removed:   removed,
+	})
+}
+
+func (b *Bot) voteReactionsPath() string {
+	return b.dataDir + eventsDir + voteReactionsFile
+}
+
+func (b *Bot) recordVoteReaction(reaction *voteReaction) error {
+	b.voteReactionsLock.Lock()
+	defer b.voteReactionsLock.Unlock()
+	err := ensureDirExists(b.dataDir + eventsDir)
+	if err != nil {
+		return err
+	}
+	reactionBytes, err := json.Marshal(reaction)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(b.voteReactionsPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(reactionBytes, '\n'))
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// reactionTimeline returns when each person added each of their reactions to a vote prompt, by user and then
+// by reaction. A reaction that was removed and added again counts from when it was added again.
+func (b *Bot) reactionTimeline(messageTS string) (map[string]map[string]time.Time, error) {
+	b.voteReactionsLock.Lock()
+	defer b.voteReactionsLock.Unlock()
+	timeline := map[string]map[string]time.Time{}
+	file, err := os.Open(b.voteReactionsPath())
+	if os.IsNotExist(err) {
+		return timeline, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		reaction := &voteReaction{}
+		err = json.Unmarshal(scanner.Bytes(), reaction)
+		if err != nil {
+			return nil, err
+		}
+		if reaction.MessageTS != messageTS {
+			continue
+		}
+		if timeline[reaction.User] == nil {
+			timeline[reaction.User] = map[string]time.Time{}
+		}
+		if reaction.Removed {
+			delete(timeline[reaction.User], reaction.Reaction)
+		} else if _, ok := timeline[reaction.User][reaction.Reaction]; !ok {
+			timeline[reaction.User][reaction.Reaction] = reaction.Time
+		}
+	}
+	return timeline, scanner.Err()
+}
@@ -0,0 +1,373 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// Slack's limits for Block Kit messages, see https://api.slack.com/reference/block-kit/blocks.
+const (
+	maxBlocksPerMessage = 50
+	maxSectionText      = 3000
+	maxHeaderText       = 150
+)
+
+// renderedMessage is a message made of Block Kit blocks. text is the same message as plain text.
+// Slack shows it in notifications and in clients that can not show blocks, and it is what the
+// bot reads back from the channel history, so it has to stay the same as before there were blocks.
+type renderedMessage struct {
+	text   string
+	blocks []slack.Block
+}
+
+// plainMessage is a message without blocks.
+func plainMessage(text string) *renderedMessage {
+	return &renderedMessage{text: text}
+}
+
+// msgOptions are the options to post or edit the message with. Blocks are left out with plain_text_messages.
+func (m *renderedMessage) msgOptions(plainText bool) []slack.MsgOption {
+	options := []slack.MsgOption{slack.MsgOptionText(m.text, false)}
+	if len(m.blocks) > 0 && !plainText {
+		options = append(options, slack.MsgOptionBlocks(m.blocks...))
+	}
+	return options
+}
+
+// namedMentionRegex matches the mentions of interactive previews, which have the name to show in the DM.
+var namedMentionRegex = regexp.MustCompile(`<@([A-Z0-9]+)\|([^>]+)>`)
+
+// printableMentions is the message for the DM of an interactive preview, with @name instead of the mentions.
+func printableMentions(message *renderedMessage) *renderedMessage {
+	return message.mapText(func(text string) string { return namedMentionRegex.ReplaceAllString(text, "@$2") })
+}
+
+// postableMentions is the message as it is posted when the preview is approved, with mentions that ping.
+func postableMentions(message *renderedMessage) *renderedMessage {
+	return message.mapText(func(text string) string { return namedMentionRegex.ReplaceAllString(text, "<@$1>") })
+}
+
+// mapText returns a copy of the message with the plain text and the text in the blocks changed by fn.
+func (m *renderedMessage) mapText(fn func(string) string) *renderedMessage {
+	mapped := &renderedMessage{text: fn(m.text)}
+	for _, block := range m.blocks {
+		switch block := block.(type) {
+		case *slack.SectionBlock:
+			section := *block
+			if block.Text != nil {
+				text := *block.Text
+				text.Text = fn(text.Text)
+				section.Text = &text
+			}
+			mapped.blocks = append(mapped.blocks, &section)
+		case *slack.ContextBlock:
+			context := *block
+			context.ContextElements.Elements = nil
+			for _, element := range block.ContextElements.Elements {
+				if object, ok := element.(*slack.TextBlockObject); ok {
+					text := *object
+					text.Text = fn(text.Text)
+					element = &text
+				}
+				context.ContextElements.Elements = append(context.ContextElements.Elements, element)
+			}
+			mapped.blocks = append(mapped.blocks, &context)
+		default:
+			mapped.blocks = append(mapped.blocks, block)
+		}
+	}
+	return mapped
+}
+
+// messageBuilder adds blocks to a message, and starts another message when one is full.
+type messageBuilder struct {
+	messages []*renderedMessage
+}
+
+func (m *messageBuilder) add(block slack.Block, text string) {
+	var last *renderedMessage
+	if len(m.messages) > 0 {
+		last = m.messages[len(m.messages)-1]
+	}
+	if last == nil || len(last.blocks) == maxBlocksPerMessage || len(last.text)+len(text) > maxCharactersPerMessage {
+		last = &renderedMessage{}
+		m.messages = append(m.messages, last)
+	}
+	last.blocks = append(last.blocks, block)
+	if last.text != "" && text != "" {
+		last.text += "\n"
+	}
+	last.text += text
+}
+
+// header adds a title in large text. Headers can not have formatting, so the text loses its bold.
+func (m *messageBuilder) header(text string) {
+	text = strings.TrimSpace(text)
+	title := strings.ReplaceAll(text, "*", "")
+	if len(title) > maxHeaderText {
+		title = title[:maxHeaderText-3] + "..."
+	}
+	m.add(slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, title, true, false)), text)
+}
+
+// section adds formatted text. Text that is too long for one section is split between lines.
+func (m *messageBuilder) section(text string) {
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return
+	}
+	for _, part := range splitLines(text, maxSectionText) {
+		m.add(slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, part, false, false), nil, nil), part)
+	}
+}
+
+// context adds small gray text, for notes below the main content.
+func (m *messageBuilder) context(text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	for _, part := range splitLines(text, maxSectionText) {
+		m.add(slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, part, false, false)), part)
+	}
+}
+
+func (m *messageBuilder) divider() {
+	m.add(slack.NewDividerBlock(), "")
+}
+
+func (m *messageBuilder) build() []*renderedMessage {
+	return m.messages
+}
+
+// splitLines splits the text into parts of at most max bytes, between lines when it can.
+func splitLines(text string, max int) []string {
+	var parts []string
+	var part string
+	for _, line := range strings.Split(text, "\n") {
+		for len(line) > max {
+			if part != "" {
+				parts = append(parts, part)
+				part = ""
+			}
+			parts = append(parts, line[:max])
+			line = line[max:]
+		}
+		if part != "" && len(part)+1+len(line) > max {
+			parts = append(parts, part)
+			part = ""
+		}
+		if part != "" {
+			part += "\n"
+		}
+		part += line
+	}
+	if part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// renderEmojiGrid renders the intro and the new emojis, in rows of rowLength.
+// The plain text ends with the last emoji, which is how runs without saved state find it.
+func renderEmojiGrid(intro string, names []string, rowLength int) []*renderedMessage {
+	builder := &messageBuilder{}
+	builder.section(intro)
+	for start := 0; start < len(names); start += rowLength {
+		end := start + rowLength
+		if end > len(names) {
+			end = len(names)
+		}
+		builder.section(":" + strings.Join(names[start:end], "::") + ":")
+	}
+	return builder.build()
+}
+
+// renderVotePrompt renders the message that people vote on. Its plain text is votePrompt,
+// which is how the vote prompts are found in the channel.
+func renderVotePrompt() *renderedMessage {
+	builder := &messageBuilder{}
+	builder.section(votePrompt)
+	builder.context("React with the new emojis above. The top ones are announced next week.")
+	message := builder.build()[0]
+	message.text = votePrompt
+	return message
+}
+
+// renderLeaderboard renders a ranking: a title, one line per place, and notes below it.
+func renderLeaderboard(title string, lines []string, notes ...string) []*renderedMessage {
+	builder := &messageBuilder{}
+	builder.header(title)
+	builder.section(strings.Join(lines, "\n"))
+	if len(notes) > 0 {
+		builder.divider()
+		for _, note := range notes {
+			builder.context(note)
+		}
+	}
+	return builder.build()
+}
+
+// renderReviewPrompt renders the message with the buttons that decide what happens to a preview.
+// The buttons are the point of the message, so it always has blocks, even with plain_text_messages.
+func renderReviewPrompt(review *pendingReview, channel string) *renderedMessage {
+	text := fmt.Sprintf(reviewPromptMessage, review.Report, len(review.channelEntries(channel)), channel)
+	builder := &messageBuilder{}
+	builder.section(text)
+	approve := slack.NewButtonBlockElement(reviewApproveAction, review.ID, slack.NewTextBlockObject(slack.PlainTextType, "Approve", false, false))
+	approve.Style = slack.StylePrimary
+	editSkipList := slack.NewButtonBlockElement(reviewEditSkipListAction, review.ID, slack.NewTextBlockObject(slack.PlainTextType, "Edit skip list", false, false))
+	reject := slack.NewButtonBlockElement(reviewRejectAction, review.ID, slack.NewTextBlockObject(slack.PlainTextType, "Reject", false, false))
+	reject.Style = slack.StyleDanger
+	builder.add(slack.NewActionBlock(reviewActionsBlock, approve, editSkipList, reject), "")
+	return builder.build()[0]
+}
+
+// renderSkipListEditor renders the modal where reviewers edit the emojis that they left out.
+func renderSkipListEditor(reviewId string, skipped []string) slack.ModalViewRequest {
+	input := slack.NewPlainTextInputBlockElement(slack.NewTextBlockObject(slack.PlainTextType, "party-parrot another-emoji", false, false), skipListAction)
+	input.Multiline = true
+	input.InitialValue = strings.Join(skipped, "\n")
+	inputBlock := slack.NewInputBlock(skipListBlock, slack.NewTextBlockObject(slack.PlainTextType, "Emojis to leave out", false, false), input)
+	inputBlock.Optional = true
+	inputBlock.Hint = slack.NewTextBlockObject(slack.PlainTextType, "One emoji name per line. These are left out on top of skip_emojis from the config file.", false, false)
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      skipListCallback,
+		PrivateMetadata: reviewId,
+		Title:           slack.NewTextBlockObject(slack.PlainTextType, "Edit skip list", false, false),
+		Submit:          slack.NewTextBlockObject(slack.PlainTextType, "Save and redo", false, false),
+		Close:           slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false),
+		Blocks:          slack.Blocks{BlockSet: []slack.Block{inputBlock}},
+	}
+}
+
+// renderSnapshotDiff renders the changes between two emoji snapshots, with a section for each kind of change.
+// Deleted emojis can not be shown, so only their names are.
+func renderSnapshotDiff(title string, diff *snapshotDiff) []*renderedMessage {
+	builder := &messageBuilder{}
+	builder.header(title)
+	if diff.empty() {
+		builder.section("No emojis changed.")
+		return builder.build()
+	}
+	addSection := func(name string, lines []string) {
+		if len(lines) > 0 {
+			builder.section(fmt.Sprintf("*%v (%d):*\n%v", name, len(lines), strings.Join(lines, "\n")))
+		}
+	}
+	var lines []string
+	for _, emoji := range diff.Added {
+		lines = append(lines, fmt.Sprintf(":%s: %s", emoji.Name, emoji.Name))
+	}
+	addSection("New emojis", lines)
+	lines = nil
+	for _, emoji := range diff.Deleted {
+		lines = append(lines, emoji.Name)
+	}
+	addSection("Deleted emojis", lines)
+	lines = nil
+	for _, change := range diff.Reuploaded {
+		lines = append(lines, fmt.Sprintf(":%s: %s", change.New.Name, change.New.Name))
+	}
+	addSection("Re-uploaded", lines)
+	lines = nil
+	for _, change := range diff.Renamed {
+		lines = append(lines, fmt.Sprintf("%s → :%s: %s", change.Old.Name, change.New.Name, change.New.Name))
+	}
+	addSection("Likely renamed", lines)
+	lines = nil
+	for _, emoji := range diff.AliasesAdded {
+		lines = append(lines, fmt.Sprintf(":%s: %s → %s", emoji.Name, emoji.Name, emoji.AliasFor))
+	}
+	addSection("New aliases", lines)
+	lines = nil
+	for _, emoji := range diff.AliasesRemoved {
+		lines = append(lines, fmt.Sprintf("%s, was for %s", emoji.Name, emoji.AliasFor))
+	}
+	addSection("Removed aliases", lines)
+	lines = nil
+	for _, change := range diff.Realiased {
+		now := "its own image"
+		if change.New.AliasFor != "" {
+			now = change.New.AliasFor
+		}
+		was := "its own image"
+		if change.Old.AliasFor != "" {
+			was = change.Old.AliasFor
+		}
+		lines = append(lines, fmt.Sprintf(":%s: %s → %s, was %s", change.New.Name, change.New.Name, now, was))
+	}
+	addSection("Re-aliased", lines)
+	if len(diff.Renamed) > 0 {
+		builder.divider()
+		builder.context("Renames are guessed from a deleted emoji and a new emoji with the same image.")
+	}
+	return builder.build()
+}
+
+// renderDuplicateImages renders the new emojis that are copies of older emojis, and suggests an alias instead.
+func renderDuplicateImages(duplicates []*duplicateImage, skipped bool) []*renderedMessage {
+	builder := &messageBuilder{}
+	builder.section("*Possible duplicate emojis:*")
+	var lines []string
+	for _, duplicate := range duplicates {
+		same := "looks like"
+		if duplicate.Exact {
+			same = "is the same image as"
+		}
+		lines = append(lines, fmt.Sprintf(":%s: %s %s :%s: %s, it could be an alias for it.",
+			duplicate.Emoji.Name, duplicate.Emoji.Name, same, duplicate.Original, duplicate.Original))
+	}
+	builder.section(strings.Join(lines, "\n"))
+	if skipped {
+		builder.context("These are left out of the new emoji post.")
+	}
+	return builder.build()
+}
+
+// renderExcludedVotes lists the votes that were not counted, by reason, and then by voter. names has the
+// name of each voter.
+func renderExcludedVotes(excluded []*excludedVote, names map[string]string) []*renderedMessage {
+	builder := &messageBuilder{}
+	builder.section("*Votes that were not counted:*")
+	for _, reason := range exclusionReasons {
+		byVoter := map[string][]string{}
+		var voters []string
+		var unlisted []string
+		for _, vote := range excluded {
+			if vote.reason != reason {
+				continue
+			}
+			if vote.voter == "" {
+				unlisted = append(unlisted, fmt.Sprintf(":%s: %d", vote.emoji, vote.votes))
+				continue
+			}
+			name := names[vote.voter]
+			if name == "" {
+				name = vote.voter
+			}
+			if _, ok := byVoter[name]; !ok {
+				voters = append(voters, name)
+			}
+			byVoter[name] = append(byVoter[name], fmt.Sprintf(":%s:", vote.emoji))
+		}
+		if len(voters) == 0 && len(unlisted) == 0 {
+			continue
+		}
+		sort.Strings(voters)
+		lines := []string{fmt.Sprintf("*%s:*", reason)}
+		for _, voter := range voters {
+			lines = append(lines, fmt.Sprintf("%s: %s", voter, strings.Join(byVoter[voter], " ")))
+		}
+		if len(unlisted) > 0 {
+			lines = append(lines, "Votes from people that Slack does not list: "+strings.Join(unlisted, ", "))
+		}
+		builder.section(strings.Join(lines, "\n"))
+	}
+	return builder.build()
+}
@@ -0,0 +1,112 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestRenderEmojiGridSplitsAtBlockLimit(t *testing.T) {
+	var names []string
+	for i := 0; i < 60*emojisPerRow; i++ {
+		names = append(names, "e"+strconv.Itoa(i))
+	}
+	messages := renderEmojiGrid("intro", names, emojisPerRow)
+	if len(messages) < 2 {
+		t.Fatalf("expected the grid to be split, got %d messages", len(messages))
+	}
+	for i, message := range messages {
+		if len(message.blocks) > maxBlocksPerMessage {
+			t.Errorf("message %d has %d blocks", i, len(message.blocks))
+		}
+		if len(message.text) > maxCharactersPerMessage {
+			t.Errorf("message %d has %d characters", i, len(message.text))
+		}
+	}
+	if !strings.HasPrefix(messages[0].text, "intro\n:e0::e1:") {
+		t.Errorf("unexpected start %q", messages[0].text[:20])
+	}
+	last := messages[len(messages)-1].text
+	if !strings.HasSuffix(last, ":"+names[len(names)-1]+":") {
+		t.Errorf("the plain text should end with the last emoji, got %q", last[len(last)-20:])
+	}
+}
+
+func TestRenderLeaderboardSplitsLongSections(t *testing.T) {
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, strconv.Itoa(i+1)+". Somebody With A Long Name (<@U0000000>) 12")
+	}
+	messages := renderLeaderboard(":trophy: *Top*\n", lines, "a note")
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages", len(messages))
+	}
+	for _, block := range messages[0].blocks {
+		if len(blockText(block)) > maxSectionText {
+			t.Errorf("a block has %d characters", len(blockText(block)))
+		}
+	}
+	if !strings.HasPrefix(messages[0].text, ":trophy: *Top*\n1. Somebody") || !strings.HasSuffix(messages[0].text, "a note") {
+		t.Errorf("unexpected plain text %q", messages[0].text)
+	}
+	if title := blockText(messages[0].blocks[0]); title != ":trophy: Top" {
+		t.Errorf("the header should not have formatting, got %q", title)
+	}
+}
+
+func TestWeeklyPostsBlocks(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 24*time.Hour)
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var foundPrompt bool
+	for _, message := range server.Posted() {
+		if message.Text == votePrompt {
+			foundPrompt = true
+			if !strings.Contains(message.Blocks, `"type":"section"`) {
+				t.Errorf("the vote prompt has no blocks: %q", message.Blocks)
+			}
+		}
+	}
+	if !foundPrompt {
+		t.Error("the vote prompt was not posted with its plain text")
+	}
+}
+
+func TestWeeklyPlainTextMessages(t *testing.T) {
+	b, server := setupWeekly(t)
+	b.config.PlainTextMessages = true
+	addEmoji(server, "new-one", "U1", 24*time.Hour)
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range server.Posted() {
+		if message.Blocks != "" {
+			t.Errorf("posted blocks with plain_text_messages: %q", message.Blocks)
+		}
+	}
+}
+
+func blockText(block slack.Block) string {
+	switch block := block.(type) {
+	case *slack.HeaderBlock:
+		return block.Text.Text
+	case *slack.SectionBlock:
+		return block.Text.Text
+	case *slack.ContextBlock:
+		var texts []string
+		for _, element := range block.ContextElements.Elements {
+			if text, ok := element.(*slack.TextBlockObject); ok {
+				texts = append(texts, text.Text)
+			}
+		}
+		return strings.Join(texts, " ")
+	}
+	return ""
+}
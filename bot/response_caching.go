@@ -0,0 +1,176 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ryho/slack-emoji-bot/util"
+)
+
+const (
+	// Where the snapshots, images and state go by default, in the home directory.
+	defaultDataDir = "/Documents/emojiSnapshots/"
+	imagesDir      = "images/"
+)
+
+// ensureDirExists makes the directory and its parents if they do not exist.
+func ensureDirExists(path string) error {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return os.MkdirAll(path, 0777)
+	}
+	return nil
+}
+
+func (b *Bot) cacheEmojiResponse(commandResponse *SlackEmojiResponseMessage) error {
+	err := ensureDirExists(b.dataDir)
+	if err != nil {
+		return err
+	}
+	responseBytes, err := json.Marshal(commandResponse)
+	if err != nil {
+		return err
+	}
+	fileName := b.dataDir + b.now().String() + ".json"
+	return ioutil.WriteFile(fileName, responseBytes, 0644)
+}
+
+// RunDeleted reports the emojis deleted since the last emoji snapshot.
+func (b *Bot) RunDeleted() error {
+	return b.report("deleted", func() error {
+		// getAllEmojis saves the snapshot that the previous one is compared to. Even in fast mode, every
+		// emoji is downloaded, since the history does not know about the emojis deleted while serve was down.
+		allEmojis, err := b.getAllEmojis()
+		if err != nil {
+			return err
+		}
+		return b.detectDeletedEmojis(allEmojis, true)
+	})
+}
+
+// detectDeletedEmojis reports the emojis that Socket Mode saw removed since the last run. If compareSnapshots
+// is set, it also reports the emojis from the previous snapshot that are missing from the response.
+func (b *Bot) detectDeletedEmojis(response *SlackEmojiResponseMessage, compareSnapshots bool) error {
+	lastResponseBytes, err := b.readLastEmojiDump(1)
+	if err != nil {
+		return err
+	}
+	lastResponse := &SlackEmojiResponseMessage{}
+	if lastResponseBytes != nil {
+		lastResponse, err = parseEmojiResponse(lastResponseBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	var missingEmojis []*Emoji
+	missingNames := util.StringSet{}
+	if compareSnapshots && lastResponseBytes != nil {
+		allCurrentEmojis := make(util.StringSet)
+		for _, emoji := range response.Emoji {
+			allCurrentEmojis[emoji.Name] = util.SetEntry{}
+		}
+		for _, emoji := range lastResponse.Emoji {
+			if _, ok := allCurrentEmojis[emoji.Name]; !ok {
+				missingEmojis = append(missingEmojis, emoji)
+				missingNames[emoji.Name] = util.SetEntry{}
+			}
+		}
+	}
+
+	// This also catches emojis that were added and removed between snapshots, and works in fast mode.
+	removedNames, err := b.removedEmojiNames(b.lastRunTime())
+	if err != nil {
+		return err
+	}
+	lastEmojis := make(map[string]*Emoji, len(lastResponse.Emoji))
+	for _, emoji := range lastResponse.Emoji {
+		lastEmojis[emoji.Name] = emoji
+	}
+	for _, name := range removedNames {
+		if _, ok := missingNames[name]; ok {
+			continue
+		}
+		missingNames[name] = util.SetEntry{}
+		if lastEmoji, ok := lastEmojis[name]; ok {
+			missingEmojis = append(missingEmojis, lastEmoji)
+		} else {
+			missingEmojis = append(missingEmojis, &Emoji{Name: name})
+		}
+	}
+
+	if len(missingEmojis) == 0 && (!compareSnapshots || lastResponseBytes == nil) {
+		return nil
+	}
+	var peopleIds []string
+	for _, emoji := range missingEmojis {
+		if emoji.UserId != "" {
+			peopleIds = append(peopleIds, emoji.UserId)
+		}
+	}
+	message := "\nDeleted Emojis:\n\n"
+	userMap, err := b.getUsers(peopleIds)
+	if err != nil {
+		return err
+	}
+	// Upload times are in time_zone, like the schedule.
+	location, err := b.config.Location()
+	if err != nil {
+		return err
+	}
+	for _, emoji := range missingEmojis {
+		user, ok := userMap[emoji.UserId]
+		if !ok {
+			// Only the name is known for emojis that were not in the previous snapshot.
+			message += fmt.Sprintf("%s \n", emoji.Name)
+			continue
+		}
+		message += fmt.Sprintf("%s (@%s) %v %s \n", emoji.Name, user.Name, time.Unix(int64(emoji.Created), 0).In(location), emoji.Url)
+	}
+	message += "\n"
+	_, err = b.printMessage(MSG_TYPE__REVIEW_ONLY, message)
+	return err
+}
+
+func (b *Bot) readLastEmojiDump(offset int) ([]byte, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("negative offset not allowed. Offset was %d", offset)
+	}
+	fileNames, err := b.emojiSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	if len(fileNames) <= offset {
+		return nil, nil
+	}
+	selectedName := fileNames[len(fileNames)-1-offset]
+	fileContents, err := ioutil.ReadFile(b.dataDir + selectedName)
+	if err != nil {
+		return nil, err
+	}
+	return fileContents, nil
+}
+
+// emojiSnapshots returns the file names of the emoji snapshots, oldest first.
+func (b *Bot) emojiSnapshots() ([]string, error) {
+	files, err := ioutil.ReadDir(b.dataDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	fileNames := make([]string, 0, len(files))
+	for _, file := range files {
+		// Skip directories and hidden files
+		if !file.IsDir() && file.Name()[0] != '.' {
+			fileNames = append(fileNames, file.Name())
+		}
+	}
+	sort.Strings(fileNames)
+	return fileNames, nil
+}
@@ -0,0 +1,443 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ryho/slack-emoji-bot/util"
+	"github.com/slack-go/slack"
+)
+
+const (
+	reviewsDir      = "reviews/"
+	reviewAuditFile = "review_audit.jsonl"
+
+	REVIEW_STATUS__PENDING    = "pending"
+	REVIEW_STATUS__APPROVED   = "approved"
+	REVIEW_STATUS__REJECTED   = "rejected"
+	REVIEW_STATUS__SUPERSEDED = "superseded"
+
+	// The IDs of the buttons and the modal, which come back in the interactions.
+	reviewActionsBlock       = "review"
+	reviewApproveAction      = "review_approve"
+	reviewEditSkipListAction = "review_edit_skip_list"
+	reviewRejectAction       = "review_reject"
+	skipListCallback         = "review_skip_list"
+	skipListBlock            = "skip_list"
+	skipListAction           = "skipped_emojis"
+
+	reviewPromptMessage     = ":eyes: That was the preview of the %v report. *Approve* posts the %d messages that go to the channel to %v, as they are."
+	reviewApprovedMessage   = ":white_check_mark: <@%s> approved the preview of the %v report, and it was posted to %v."
+	reviewRejectedMessage   = ":x: <@%s> rejected the preview of the %v report, so it was not posted."
+	reviewSupersededMessage = ":arrows_counterclockwise: This preview of the %v report was replaced by a newer one."
+	reviewRedoMessage       = ":pencil2: <@%s> edited the skip list, so there is a new preview of the %v report."
+	reviewNoRedoMessage     = ":pencil2: <@%s> edited the skip list. Run the %v report again for a new preview."
+)
+
+// pendingReview is a preview that the reviewers DMed with interactive_review. Approving it posts
+// its entries to emoji_channel as they were previewed, without running the report again.
+type pendingReview struct {
+	ID      string    `json:"id"`
+	Report  string    `json:"report"`
+	Created time.Time `json:"created"`
+	Status  string    `json:"status"`
+	// Who approved, rejected or replaced the preview, and when.
+	DecidedBy string    `json:"decided_by,omitempty"`
+	Decided   time.Time `json:"decided,omitempty"`
+	// Everything the run sent. Only the entries for emoji_channel are posted.
+	Entries []*TranscriptEntry `json:"entries"`
+	// The timestamps of the entries that were posted so far, by entry ID, so that an approval that
+	// failed part way does not post anything twice when it is approved again.
+	Posted map[string]string `json:"posted,omitempty"`
+	// The weekly run, which is saved to the state when the preview is posted. Its VoteMessageTS is
+	// the ID of the entry of the vote prompt until then.
+	Run *runRecord `json:"run,omitempty"`
+	// The messages with the buttons, one for each reviewer.
+	Prompts []*journalMessage `json:"prompts"`
+}
+
+// reviewAuditEntry is one decision about a preview. They are appended to state/review_audit.jsonl.
+type reviewAuditEntry struct {
+	Time     time.Time `json:"time"`
+	Review   string    `json:"review"`
+	Report   string    `json:"report"`
+	UserID   string    `json:"user_id"`
+	UserName string    `json:"user_name,omitempty"`
+	Action   string    `json:"action"`
+	Detail   string    `json:"detail,omitempty"`
+}
+
+func (r *pendingReview) channelEntries(channel string) []*TranscriptEntry {
+	var entries []*TranscriptEntry
+	for _, entry := range r.Entries {
+		if entry.Destination == channel {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// reviewsInteractively is true when previews are approved with buttons instead of by running again in full_send.
+func (b *Bot) reviewsInteractively() bool {
+	return b.config.RunMode == MODE__DM_FOR_REVIEW && b.config.InteractiveReview
+}
+
+func (b *Bot) reviewPath(id string) string {
+	return b.dataDir + stateDir + reviewsDir + id + ".json"
+}
+
+func (b *Bot) loadReview(id string) (*pendingReview, error) {
+	contents, err := ioutil.ReadFile(b.reviewPath(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("there is no preview %v", id)
+	} else if err != nil {
+		return nil, err
+	}
+	review := &pendingReview{}
+	err = json.Unmarshal(contents, review)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %v: %w", b.reviewPath(id), err)
+	}
+	return review, nil
+}
+
+func (b *Bot) saveReview(review *pendingReview) error {
+	err := ensureDirExists(b.dataDir + stateDir + reviewsDir)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(b.reviewPath(review.ID), review)
+}
+
+// pendingReviews returns the previews that nobody decided on yet, oldest first.
+func (b *Bot) pendingReviews() ([]*pendingReview, error) {
+	files, err := ioutil.ReadDir(b.dataDir + stateDir + reviewsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var reviews []*pendingReview
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		review, err := b.loadReview(strings.TrimSuffix(file.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		if review.Status == REVIEW_STATUS__PENDING {
+			reviews = append(reviews, review)
+		}
+	}
+	sort.Slice(reviews, func(i, j int) bool { return reviews[i].ID < reviews[j].ID })
+	return reviews, nil
+}
+
+// startReview saves what the report sent as a preview, and DMs the reviewers the buttons to decide on it.
+// rerun makes a new preview after the skip list is edited.
+func (b *Bot) startReview(report string, rerun func() error) error {
+	review := &pendingReview{
+		ID:      b.now().UTC().Format("20060102T150405.000000000Z"),
+		Report:  report,
+		Created: b.now(),
+		Status:  REVIEW_STATUS__PENDING,
+		Entries: b.transcript.entries,
+	}
+	if len(review.channelEntries(b.config.EmojiChannel)) == 0 {
+		// Nothing would be posted, so there is nothing to approve.
+		return nil
+	}
+	if b.thisRun != nil && b.thisRun.VoteMessageTS != "" {
+		run := *b.thisRun
+		run.VoteMessageTS = b.transcript.entryIds[run.VoteMessageTS]
+		review.Run = &run
+	}
+
+	b.reviewLock.Lock()
+	defer b.reviewLock.Unlock()
+	older, err := b.pendingReviews()
+	if err != nil {
+		return err
+	}
+	for _, old := range older {
+		if old.Report != report {
+			continue
+		}
+		// Only the newest preview of a report can be posted.
+		err = b.decideReview(old, REVIEW_STATUS__SUPERSEDED, "", fmt.Sprintf(reviewSupersededMessage, report))
+		if err != nil {
+			return err
+		}
+	}
+
+	prompt := renderReviewPrompt(review, b.config.EmojiChannel)
+	for _, id := range append(b.config.AdditionalReviewerIds, b.config.OwnerUserId) {
+		channel, ts, err := b.slack.PostMessage(id, prompt.msgOptions(false)...)
+		if err != nil {
+			return err
+		}
+		review.Prompts = append(review.Prompts, &journalMessage{Channel: channel, TS: ts, Text: prompt.text})
+	}
+	err = b.saveReview(review)
+	if err != nil {
+		return err
+	}
+	b.reruns[review.ID] = rerun
+	return nil
+}
+
+// decideReview sets the status of the review, and replaces the buttons of its prompts with the message.
+func (b *Bot) decideReview(review *pendingReview, status, userId, message string) error {
+	review.Status = status
+	review.DecidedBy = userId
+	review.Decided = b.now()
+	err := b.saveReview(review)
+	if err != nil {
+		return err
+	}
+	delete(b.reruns, review.ID)
+	builder := &messageBuilder{}
+	builder.section(message)
+	// The blocks replace the buttons, so they are sent even with plain_text_messages.
+	options := builder.build()[0].msgOptions(false)
+	for _, prompt := range review.Prompts {
+		_, _, _, err = b.slack.UpdateMessage(prompt.Channel, prompt.TS, options...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isReviewer is true for the owner and additional_reviewer_ids.
+func (b *Bot) isReviewer(userId string) bool {
+	for _, id := range append(b.config.AdditionalReviewerIds, b.config.OwnerUserId) {
+		if id == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// handleInteraction handles the buttons of the review prompts, and the skip list modal.
+func (b *Bot) handleInteraction(callback *slack.InteractionCallback) error {
+	switch callback.Type {
+	case slack.InteractionTypeBlockActions:
+		for _, action := range callback.ActionCallback.BlockActions {
+			var err error
+			switch action.ActionID {
+			case reviewApproveAction:
+				err = b.approveReview(action.Value, &callback.User)
+			case reviewRejectAction:
+				err = b.rejectReview(action.Value, &callback.User)
+			case reviewEditSkipListAction:
+				err = b.openSkipListEditor(action.Value, &callback.User, callback.TriggerID)
+			default:
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case slack.InteractionTypeViewSubmission:
+		if callback.View.CallbackID != skipListCallback {
+			return nil
+		}
+		var value string
+		if callback.View.State != nil {
+			value = callback.View.State.Values[skipListBlock][skipListAction].Value
+		}
+		return b.editSkipList(callback.View.PrivateMetadata, &callback.User, value)
+	}
+	return nil
+}
+
+// reviewToDecide loads a review that the user can decide on, or returns nil if it was decided already.
+func (b *Bot) reviewToDecide(id string, user *slack.User) (*pendingReview, error) {
+	if !b.isReviewer(user.ID) {
+		return nil, fmt.Errorf("%v (%v) is not a reviewer", user.Name, user.ID)
+	}
+	review, err := b.loadReview(id)
+	if err != nil {
+		return nil, err
+	}
+	if review.Status != REVIEW_STATUS__PENDING {
+		fmt.Fprintf(b.out, "Ignoring %v, the preview %v was %v already\n", user.Name, id, review.Status)
+		return nil, nil
+	}
+	return review, nil
+}
+
+// approveReview posts the entries of the preview to emoji_channel as they were previewed. They go through
+// the routes and the sinks like the messages of a full_send run.
+func (b *Bot) approveReview(id string, user *slack.User) error {
+	// The run lock comes first, like in runJob, which takes the review lock when it starts a review.
+	b.runLock.Lock()
+	defer b.runLock.Unlock()
+	b.reviewLock.Lock()
+	defer b.reviewLock.Unlock()
+	review, err := b.reviewToDecide(id, user)
+	if err != nil || review == nil {
+		return err
+	}
+	channelId, err := b.getChannel(b.config.EmojiChannel)
+	if err != nil {
+		return err
+	}
+	b.resetRunState()
+	defer b.resetRunState()
+	b.approving = true
+	err = b.postReviewEntries(review)
+	finishErr := b.finishSinks(err == nil)
+	if err != nil {
+		return err
+	}
+	if finishErr != nil {
+		return finishErr
+	}
+	if review.Run != nil {
+		run := *review.Run
+		run.ID = review.ID
+		run.VoteChannelID = channelId
+		run.VoteMessageTS = review.Posted[run.VoteMessageTS]
+		err = b.recordRun(&run)
+		if err != nil {
+			return err
+		}
+	}
+	err = b.auditReview(review, user, REVIEW_STATUS__APPROVED, fmt.Sprintf("posted %d messages", len(review.Posted)))
+	if err != nil {
+		return err
+	}
+	return b.decideReview(review, REVIEW_STATUS__APPROVED, user.ID, fmt.Sprintf(reviewApprovedMessage, user.ID, review.Report, b.config.EmojiChannel))
+}
+
+// postReviewEntries posts the entries of the preview that are not posted yet, and saves where each one went.
+func (b *Bot) postReviewEntries(review *pendingReview) error {
+	if review.Posted == nil {
+		review.Posted = map[string]string{}
+	}
+	for _, entry := range review.channelEntries(b.config.EmojiChannel) {
+		if _, ok := review.Posted[entry.ID]; ok {
+			continue
+		}
+		level, err := ParseMessageType(entry.Type)
+		if err != nil {
+			return err
+		}
+		message := plainMessage(entry.Text)
+		if entry.Blocks != nil {
+			message.blocks = entry.Blocks.BlockSet
+		}
+		ts, err := b.printRendered(level, message, review.Posted[entry.ThreadParent])
+		if err != nil {
+			return err
+		}
+		review.Posted[entry.ID] = ts
+		err = b.saveReview(review)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bot) rejectReview(id string, user *slack.User) error {
+	b.reviewLock.Lock()
+	defer b.reviewLock.Unlock()
+	review, err := b.reviewToDecide(id, user)
+	if err != nil || review == nil {
+		return err
+	}
+	err = b.auditReview(review, user, REVIEW_STATUS__REJECTED, "")
+	if err != nil {
+		return err
+	}
+	return b.decideReview(review, REVIEW_STATUS__REJECTED, user.ID, fmt.Sprintf(reviewRejectedMessage, user.ID, review.Report))
+}
+
+func (b *Bot) openSkipListEditor(id string, user *slack.User, triggerId string) error {
+	review, err := b.reviewToDecide(id, user)
+	if err != nil || review == nil {
+		return err
+	}
+	prefs, err := b.loadPreferences()
+	if err != nil {
+		return err
+	}
+	_, err = b.slack.OpenView(triggerId, renderSkipListEditor(review.ID, prefs.SkippedEmojis.Sorted()))
+	return err
+}
+
+// editSkipList saves the skip list from the modal, and makes a new preview with it.
+func (b *Bot) editSkipList(id string, user *slack.User, value string) error {
+	b.reviewLock.Lock()
+	review, err := b.reviewToDecide(id, user)
+	if err != nil || review == nil {
+		b.reviewLock.Unlock()
+		return err
+	}
+	skipped := util.StringSet{}
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\t' }) {
+		skipped[strings.Trim(name, ":")] = util.SetEntry{}
+	}
+	err = b.updatePreferences(func(prefs *userPreferences) { prefs.SkippedEmojis = skipped })
+	if err == nil {
+		err = b.auditReview(review, user, "edit_skip_list", strings.Join(skipped.Sorted(), " "))
+	}
+	rerun := b.reruns[review.ID]
+	message := fmt.Sprintf(reviewRedoMessage, user.ID, review.Report)
+	if rerun == nil {
+		// The preview was made by another process, like a run from the command line.
+		message = fmt.Sprintf(reviewNoRedoMessage, user.ID, review.Report)
+	}
+	if err == nil {
+		err = b.decideReview(review, REVIEW_STATUS__SUPERSEDED, user.ID, message)
+	}
+	b.reviewLock.Unlock()
+	if err != nil || rerun == nil {
+		return err
+	}
+
+	b.runLock.Lock()
+	defer b.runLock.Unlock()
+	b.resetRunState()
+	defer b.resetRunState()
+	return b.report(review.Report, rerun)
+}
+
+func (b *Bot) auditReview(review *pendingReview, user *slack.User, action, detail string) error {
+	entry := &reviewAuditEntry{
+		Time:     b.now(),
+		Review:   review.ID,
+		Report:   review.Report,
+		UserID:   user.ID,
+		UserName: user.Name,
+		Action:   action,
+		Detail:   detail,
+	}
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	err = ensureDirExists(b.dataDir + stateDir)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(b.dataDir+stateDir+reviewAuditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(entryBytes, '\n'))
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,210 @@
+package bot
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryho/slack-emoji-bot/fakeslack"
+	"github.com/slack-go/slack"
+)
+
+// setupReview makes a weekly run in dm_for_review with interactive_review, and returns its preview.
+func setupReview(t *testing.T) (*Bot, *fakeslack.Server, *pendingReview) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 2*time.Hour)
+	addEmoji(server, "new-two", "U2", time.Hour)
+	b.config.RunMode = MODE__DM_FOR_REVIEW
+	b.config.InteractiveReview = true
+	b.config.AppToken = "xapp-test"
+
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posted := postedTo(server, b.config.EmojiChannel); len(posted) > 0 {
+		t.Fatalf("the preview was posted before it was approved: %v", posted)
+	}
+	reviews, err := b.pendingReviews()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 1 {
+		t.Fatalf("got %v pending previews, want 1", len(reviews))
+	}
+	return b, server, reviews[0]
+}
+
+func clickButton(b *Bot, userId, actionId, reviewId string) error {
+	return b.handleInteraction(&slack.InteractionCallback{
+		Type:      slack.InteractionTypeBlockActions,
+		User:      slack.User{ID: userId, Name: strings.ToLower(userId)},
+		TriggerID: "trigger-" + actionId,
+		ActionCallback: slack.ActionCallbacks{BlockActions: []*slack.BlockAction{
+			{ActionID: actionId, Value: reviewId},
+		}},
+	})
+}
+
+func TestApprovingAReviewPostsThePreview(t *testing.T) {
+	b, server, review := setupReview(t)
+	var prompt *fakeslack.PostedMessage
+	for i, message := range server.Posted() {
+		if message.Channel == "UOWNER" && strings.Contains(message.Blocks, reviewApproveAction) {
+			prompt = &server.Posted()[i]
+		}
+	}
+	if prompt == nil {
+		t.Fatal("the owner did not get the buttons")
+	}
+	findPosted(t, postedTo(server, "UOWNER"), votePrompt)
+
+	err := clickButton(b, "UOWNER", reviewApproveAction, review.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var channelPosts []fakeslack.PostedMessage
+	for _, message := range server.Posted() {
+		if message.Channel == b.config.EmojiChannel {
+			channelPosts = append(channelPosts, message)
+		}
+	}
+	entries := review.channelEntries(b.config.EmojiChannel)
+	if len(channelPosts) != len(entries) {
+		t.Fatalf("posted %v messages, want the %v of the preview", len(channelPosts), len(entries))
+	}
+	var voteTS string
+	var mentions bool
+	for i, entry := range entries {
+		mentions = mentions || strings.Contains(channelPosts[i].Text, "<@U")
+		if channelPosts[i].Text != entry.Text {
+			t.Errorf("posted %q, want %q from the preview", channelPosts[i].Text, entry.Text)
+		}
+		if entry.Text == votePrompt {
+			voteTS = channelPosts[i].TS
+		} else if entry.ThreadParent != "" && channelPosts[i].ThreadTS == "" {
+			t.Errorf("%q was not posted in a thread", entry.Text)
+		}
+	}
+
+	if !mentions {
+		t.Error("the approved preview does not mention the uploaders")
+	}
+	for _, message := range postedTo(server, "UOWNER") {
+		if strings.Contains(message, "<@U1") || strings.Contains(message, "<@U2") {
+			t.Errorf("the preview DM pings the uploaders: %q", message)
+		}
+	}
+
+	state, err := b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := state.lastRun()
+	if run == nil || run.VoteMessageTS != voteTS || run.VoteChannelID != testChannelId || run.LastNewEmoji != "new-two" {
+		t.Errorf("unexpected saved run %+v, want the vote prompt %v", run, voteTS)
+	}
+	audit, err := ioutil.ReadFile(b.dataDir + stateDir + reviewAuditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(audit), `"user_id":"UOWNER"`) || !strings.Contains(string(audit), `"action":"approved"`) {
+		t.Errorf("the approval is not in the audit log: %s", audit)
+	}
+
+	// Approving again, like another reviewer clicking at the same time, does not post it twice.
+	err = clickButton(b, "UOWNER", reviewApproveAction, review.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(postedTo(server, b.config.EmojiChannel)); got != len(entries) {
+		t.Errorf("approving twice posted %v messages", got)
+	}
+	for _, message := range server.Posted() {
+		if message.TS == prompt.TS && (!message.Edited || strings.Contains(message.Blocks, reviewApproveAction)) {
+			t.Errorf("the buttons were not replaced: %+v", message)
+		}
+	}
+}
+
+func TestRejectingAReviewPostsNothing(t *testing.T) {
+	b, server, review := setupReview(t)
+
+	err := clickButton(b, "U1", reviewApproveAction, review.ID)
+	if err == nil {
+		t.Error("somebody who is not a reviewer approved the preview")
+	}
+	err = clickButton(b, "UOWNER", reviewRejectAction, review.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = clickButton(b, "UOWNER", reviewApproveAction, review.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posted := postedTo(server, b.config.EmojiChannel); len(posted) > 0 {
+		t.Errorf("a rejected preview was posted: %v", posted)
+	}
+	review, err = b.loadReview(review.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if review.Status != REVIEW_STATUS__REJECTED || review.DecidedBy != "UOWNER" {
+		t.Errorf("got status %v by %v, want rejected by UOWNER", review.Status, review.DecidedBy)
+	}
+}
+
+func TestEditingTheSkipListMakesANewPreview(t *testing.T) {
+	b, server, review := setupReview(t)
+
+	err := clickButton(b, "UOWNER", reviewEditSkipListAction, review.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	views := server.Views()
+	if len(views) != 1 || views[0].View.PrivateMetadata != review.ID {
+		t.Fatalf("expected the skip list modal for %v, got %+v", review.ID, views)
+	}
+	err = b.handleInteraction(&slack.InteractionCallback{
+		Type: slack.InteractionTypeViewSubmission,
+		User: slack.User{ID: "UOWNER", Name: "owner"},
+		View: slack.View{
+			CallbackID:      skipListCallback,
+			PrivateMetadata: review.ID,
+			State: &slack.ViewState{Values: map[string]map[string]slack.BlockAction{
+				skipListBlock: {skipListAction: {Value: ":new-one:\n"}},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefs, err := b.loadPreferences()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := prefs.SkippedEmojis["new-one"]; !ok || len(prefs.SkippedEmojis) != 1 {
+		t.Errorf("got skip list %v, want new-one", prefs.SkippedEmojis.Sorted())
+	}
+	old, err := b.loadReview(review.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Status != REVIEW_STATUS__SUPERSEDED {
+		t.Errorf("the old preview is %v, want superseded", old.Status)
+	}
+	reviews, err := b.pendingReviews()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 1 || reviews[0].ID == review.ID {
+		t.Fatalf("expected one new preview, got %v", len(reviews))
+	}
+	for _, entry := range reviews[0].Entries {
+		if strings.Contains(entry.Text, "new-one") {
+			t.Errorf("the new preview has the skipped emoji: %q", entry.Text)
+		}
+	}
+}
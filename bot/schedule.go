@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression with the five standard fields:
+// minute, hour, day of month, month and day of week. Each field supports
+// *, single values, ranges (1-5), steps (*/15 or 1-30/2) and comma separated lists.
+// Day of week is 0-7 where both 0 and 7 are Sunday. Names like MON or JAN are not supported.
+type cronSchedule struct {
+	expression string
+	location   *time.Location
+
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// Like standard cron, when both day fields are restricted a day matches if either matches.
+	dayOfMonthStar, dayOfWeekStar bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+func parseCronSchedule(expression string, location *time.Location) (*cronSchedule, error) {
+	parts := strings.Fields(expression)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q should have %d fields, found %d", expression, len(cronFields), len(parts))
+	}
+	var bits [5]uint64
+	for i, part := range parts {
+		var err error
+		bits[i], err = parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expression, err)
+		}
+	}
+	// 7 is also Sunday.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronSchedule{
+		expression:     expression,
+		location:       location,
+		minute:         bits[0],
+		hour:           bits[1],
+		dayOfMonth:     bits[2],
+		month:          bits[3],
+		dayOfWeek:      bits[4],
+		dayOfMonthStar: parts[2] == "*",
+		dayOfWeekStar:  parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, bounds cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, step := item, 1
+		if i := strings.Index(item, "/"); i != -1 {
+			var err error
+			rangePart = item[:i]
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %v field %q", bounds.name, item)
+			}
+		}
+		start, end := bounds.min, bounds.max
+		if rangePart != "*" {
+			var err error
+			if i := strings.Index(rangePart, "-"); i != -1 {
+				start, err = strconv.Atoi(rangePart[:i])
+				if err == nil {
+					end, err = strconv.Atoi(rangePart[i+1:])
+				}
+			} else {
+				start, err = strconv.Atoi(rangePart)
+				end = start
+			}
+			if err != nil {
+				return 0, fmt.Errorf("invalid %v field %q", bounds.name, item)
+			}
+		}
+		if start < bounds.min || end > bounds.max || start > end {
+			return 0, fmt.Errorf("%v field %q is out of range %d-%d", bounds.name, item, bounds.min, bounds.max)
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) String() string {
+	return s.expression
+}
+
+// next returns the first time after the given time that matches the schedule.
+func (s *cronSchedule) next(after time.Time) time.Time {
+	t := after.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	// Give up after five years, which only happens for schedules like February 30th.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if s.dayOfMonthStar || s.dayOfWeekStar {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
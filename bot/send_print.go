@@ -0,0 +1,239 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/slack-go/slack"
+)
+
+type MessageType int
+
+const (
+	MSG_TYPE__SEND MessageType = iota
+	MSG_TYPE__REVIEW_ONLY
+	MSG_TYPE__SEND_AND_REVIEW
+	MSG_TYPE__DM_ONLY
+	MSG_TYPE__PRINT_ONLY
+)
+
+var messageTypeNames = map[MessageType]string{
+	MSG_TYPE__SEND:            "send",
+	MSG_TYPE__REVIEW_ONLY:     "review_only",
+	MSG_TYPE__SEND_AND_REVIEW: "send_and_review",
+	MSG_TYPE__DM_ONLY:         "dm_only",
+	MSG_TYPE__PRINT_ONLY:      "print_only",
+}
+
+func (t MessageType) String() string {
+	if name, ok := messageTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("MessageType(%d)", int(t))
+}
+
+func ParseMessageType(name string) (MessageType, error) {
+	for messageType, typeName := range messageTypeNames {
+		if typeName == name {
+			return messageType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown message type %q, expected one of send, send_and_review, review_only, dm_only or print_only", name)
+}
+
+func (b *Bot) printMessage(level MessageType, text string) (string, error) {
+	return b.printMessageWithThreadId(level, text, "")
+}
+
+func (b *Bot) printMessageWithThreadId(level MessageType, text string, threadId string) (string, error) {
+	return b.printRendered(level, plainMessage(text), threadId)
+}
+
+// printMessages prints or sends messages that were split by the renderer, one after another.
+// It returns the timestamp of the first one, to start a thread on.
+func (b *Bot) printMessages(level MessageType, messages []*renderedMessage, threadId string) (string, error) {
+	var firstTS string
+	for _, message := range messages {
+		ts, err := b.printRendered(level, message, threadId)
+		if err != nil {
+			return "", err
+		}
+		if firstTS == "" {
+			firstTS = ts
+		}
+	}
+	return firstTS, nil
+}
+
+// printRendered gives the message to every sink that messages of the level are routed to. It returns the
+// ID to reply to the message with, which is the Slack timestamp when the message went to Slack.
+func (b *Bot) printRendered(level MessageType, message *renderedMessage, threadId string) (string, error) {
+	sinkMessage := &SinkMessage{
+		Type:     level,
+		Text:     message.text,
+		Blocks:   message.blocks,
+		ThreadID: threadId,
+		Resent:   b.currentStep != nil && b.currentStep.Done,
+	}
+	var replyId string
+	for _, name := range b.routes(level) {
+		if !b.sinkRunsNow(name) {
+			continue
+		}
+		id, err := b.sinks[name].Send(sinkMessage)
+		if err != nil {
+			return "", fmt.Errorf("sink %v: %w", name, err)
+		}
+		if id != "" && (replyId == "" || name == slackSinkName) {
+			replyId = id
+		}
+	}
+	return replyId, nil
+}
+
+// sendToSlack posts, DMs or prints the message, depending on run_mode.
+func (b *Bot) sendToSlack(level MessageType, message *renderedMessage, threadId string) (string, error) {
+	if b.approving {
+		// Only the entries for emoji_channel are approved.
+		return b.sendMessage(b.config.EmojiChannel, message, threadId)
+	}
+	if b.config.RunMode == MODE__PRINT_EVERYTHING {
+		return b.dryRun(level, message, threadId)
+	}
+	ts, err := b.sendByRunMode(level, message, threadId, b.sendMessage)
+	if err != nil {
+		return "", err
+	}
+	b.addToTranscript(level, message, threadId, ts)
+	return ts, nil
+}
+
+// postFunc posts a message to a channel or DM and returns its timestamp.
+type postFunc func(dest string, message *renderedMessage, threadId string) (string, error)
+
+// sendByRunMode posts the message with post, or prints it, depending on run_mode.
+func (b *Bot) sendByRunMode(level MessageType, message *renderedMessage, threadId string, post postFunc) (string, error) {
+	switch level {
+	case MSG_TYPE__SEND:
+		if b.config.RunMode == MODE__FULL_SEND {
+			return post(b.config.EmojiChannel, message, threadId)
+		} else if b.config.RunMode == MODE__DM_FOR_REVIEW {
+			if b.config.InteractiveReview {
+				// The reviewers approve the whole preview, so they need to see all of it.
+				return b.sendToReviewers(message, threadId, post)
+			}
+			b.print(message)
+			return "", nil
+		} else if b.config.RunMode == MODE__DM_FOR_TESTING {
+			return post(b.config.OwnerUserId, message, threadId)
+		}
+	case MSG_TYPE__REVIEW_ONLY:
+		if b.config.RunMode == MODE__DM_FOR_REVIEW {
+			return b.sendToReviewers(message, threadId, post)
+		} else {
+			return "", nil
+		}
+	case MSG_TYPE__SEND_AND_REVIEW:
+		if b.config.RunMode == MODE__FULL_SEND {
+			return post(b.config.EmojiChannel, message, threadId)
+		} else if b.config.RunMode == MODE__DM_FOR_REVIEW {
+			return b.sendToReviewers(message, threadId, post)
+		} else if b.config.RunMode == MODE__DM_FOR_TESTING {
+			return post(b.config.OwnerUserId, message, threadId)
+		}
+	case MSG_TYPE__DM_ONLY:
+		if b.config.RunMode == MODE__FULL_SEND {
+			b.print(message)
+			return "", nil
+		} else if b.config.RunMode == MODE__DM_FOR_REVIEW {
+			return b.sendToReviewers(message, threadId, post)
+		} else if b.config.RunMode == MODE__DM_FOR_TESTING {
+			b.print(message)
+			return "", nil
+		}
+	case MSG_TYPE__PRINT_ONLY:
+		b.print(message)
+	default:
+		b.print(message)
+	}
+	return "", nil
+}
+
+func (b *Bot) print(message *renderedMessage) {
+	fmt.Fprint(b.out, "\n\n"+message.text+"\n\n")
+}
+
+// sendToReviewers DMs the message to every reviewer. The thread is in the DM with the first reviewer,
+// so only that DM gets the message in the thread.
+func (b *Bot) sendToReviewers(message *renderedMessage, threadId string, post postFunc) (string, error) {
+	message = printableMentions(message)
+	var firstTS string
+	for _, id := range append(b.config.AdditionalReviewerIds, b.config.OwnerUserId) {
+		ts, err := post(id, message, threadId)
+		if err != nil {
+			return "", err
+		}
+		threadId = ""
+		if firstTS == "" {
+			firstTS = ts
+		}
+	}
+	return firstTS, nil
+}
+
+// sendMessage posts the message, unless an earlier try of the run already posted it.
+// With --redo, the message of the redone run is edited instead.
+func (b *Bot) sendMessage(dest string, message *renderedMessage, threadId string) (string, error) {
+	step := b.currentStep
+	if step == nil {
+		_, ts, err := b.postMessage(dest, message, threadId)
+		return ts, err
+	}
+	index := b.stepMessages
+	b.stepMessages++
+	if index < len(step.Messages) {
+		posted := step.Messages[index]
+		if posted.Text != message.text && !step.Done {
+			err := b.editMessage(posted, message)
+			if err != nil {
+				return "", err
+			}
+			return posted.TS, b.saveJournal()
+		}
+		return posted.TS, nil
+	}
+	if step.Done {
+		return "", nil
+	}
+
+	var posted *journalMessage
+	if old := findStep(b.redoSteps, step.Name); old != nil && index < len(old.Messages) {
+		posted = old.Messages[index]
+		err := b.editMessage(posted, message)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		channel, ts, err := b.postMessage(dest, message, threadId)
+		if err != nil {
+			return "", err
+		}
+		posted = &journalMessage{Channel: channel, TS: ts, Text: message.text}
+	}
+	step.Messages = append(step.Messages, posted)
+	return posted.TS, b.saveJournal()
+}
+
+// postOutsideRun posts a message that is not part of a run, like a reply to a DM. It never goes through
+// the journal, since events come in on the Socket Mode goroutine, even while a run is in a step.
+func (b *Bot) postOutsideRun(dest string, message *renderedMessage, threadId string) (string, error) {
+	_, ts, err := b.postMessage(dest, message, threadId)
+	return ts, err
+}
+
+func (b *Bot) postMessage(dest string, message *renderedMessage, threadId string) (string, string, error) {
+	options := message.msgOptions(b.config.PlainTextMessages)
+	if threadId != "" {
+		options = append(options, slack.MsgOptionTS(threadId))
+	}
+	return b.slack.PostMessage(dest, options...)
+}
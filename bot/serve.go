@@ -0,0 +1,201 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// scheduledJob is a pipeline that the serve command runs on a schedule.
+type scheduledJob struct {
+	name     string
+	schedule *cronSchedule
+	run      func() error
+
+	nextRun   time.Time
+	lastRun   time.Time
+	lastError error
+}
+
+type scheduler struct {
+	bot  *Bot
+	mu   sync.Mutex
+	jobs []*scheduledJob
+}
+
+// Serve keeps running and runs the weekly pipeline, and Emojis Wrapped in January, on their schedules,
+// until the context is done.
+func (b *Bot) Serve(ctx context.Context) error {
+	location, err := b.config.Location()
+	if err != nil {
+		return err
+	}
+	weeklySchedule, err := parseCronSchedule(b.config.Schedule, location)
+	if err != nil {
+		return err
+	}
+	s := &scheduler{bot: b}
+	s.jobs = append(s.jobs, &scheduledJob{
+		name:     "weekly",
+		schedule: weeklySchedule,
+		run: func() error {
+			err := b.RunWeekly()
+			// The override is only meant for the next run, not every week after it.
+			b.config.OverRideLastNewEmoji = ""
+			return err
+		},
+	})
+	if b.config.WrappedSchedule != "" {
+		wrappedSchedule, err := parseCronSchedule(b.config.WrappedSchedule, location)
+		if err != nil {
+			return err
+		}
+		s.jobs = append(s.jobs, &scheduledJob{
+			name:     "wrapped",
+			schedule: wrappedSchedule,
+			run: func() error {
+				return b.RunWrapped(b.DefaultWrappedYear())
+			},
+		})
+	}
+
+	if b.config.StatusAddress != "" {
+		server := &http.Server{Addr: b.config.StatusAddress, Handler: s}
+		go func() {
+			err := server.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				fmt.Fprintf(b.out, "Status server stopped: %v\n", err)
+			}
+		}()
+		defer server.Close()
+	}
+	if b.config.AppToken != "" {
+		go func() {
+			err := b.listenForSocketModeEvents(ctx)
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(b.out, "Stopped listening for Socket Mode events: %v\n", err)
+			}
+		}()
+	}
+	return s.loop(ctx)
+}
+
+func (s *scheduler) loop(ctx context.Context) error {
+	for {
+		job := s.scheduleNext(s.bot.now())
+		if job == nil {
+			return fmt.Errorf("no scheduled runs in the next five years")
+		}
+		fmt.Fprintf(s.bot.out, "Next run: %v at %v\n", job.name, job.nextRun)
+		timer := time.NewTimer(job.nextRun.Sub(s.bot.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			fmt.Fprintln(s.bot.out, "Shutting down")
+			return nil
+		case <-timer.C:
+		}
+		s.runJob(job)
+	}
+}
+
+// scheduleNext updates the next run time of every job and returns the job that runs first.
+func (s *scheduler) scheduleNext(now time.Time) *scheduledJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var first *scheduledJob
+	for _, job := range s.jobs {
+		job.nextRun = job.schedule.next(now)
+		if job.nextRun.IsZero() {
+			continue
+		}
+		if first == nil || job.nextRun.Before(first.nextRun) {
+			first = job
+		}
+	}
+	return first
+}
+
+func (s *scheduler) runJob(job *scheduledJob) {
+	fmt.Fprintf(s.bot.out, "Starting %v run\n", job.name)
+	s.bot.runLock.Lock()
+	start := s.bot.now()
+	err := runRecovered(job.run)
+	if err != nil {
+		fmt.Fprintf(s.bot.out, "The %v run failed after %v: %v\n", job.name, s.bot.since(start), err)
+	} else {
+		fmt.Fprintf(s.bot.out, "The %v run finished in %v\n", job.name, s.bot.since(start))
+	}
+	s.bot.resetRunState()
+	s.bot.runLock.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.lastRun = start
+	job.lastError = err
+}
+
+// runRecovered turns a panic into an error, so that one bad run does not stop the server.
+func runRecovered(run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run()
+}
+
+// resetRunState clears what one run of a pipeline leaves behind.
+func (b *Bot) resetRunState() {
+	b.lastNewEmoji = ""
+	b.previousLastNewEmoji = ""
+	b.lastNewEmojiCreated = 0
+	b.previousLastNewEmojiCreated = 0
+	b.reactionMessage = nil
+	b.newestSkippedEmoji = nil
+	b.previousRun = nil
+	b.thisRun = nil
+	b.journal = nil
+	b.currentStep = nil
+	b.stepMessages = 0
+	b.redoSteps = nil
+	b.approving = false
+}
+
+type jobStatus struct {
+	Name      string    `json:"name"`
+	Schedule  string    `json:"schedule"`
+	NextRun   time.Time `json:"next_run"`
+	LastRun   time.Time `json:"last_run"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// ServeHTTP reports the schedule and the next run time of every job.
+func (s *scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	statuses := make([]jobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		status := jobStatus{
+			Name:     job.name,
+			Schedule: job.schedule.String(),
+			NextRun:  job.nextRun,
+			LastRun:  job.lastRun,
+		}
+		if job.lastError != nil {
+			status.LastError = job.lastError.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	s.mu.Unlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].NextRun.Before(statuses[j].NextRun) })
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(statuses)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,404 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// The built in sinks, which do not need to be in the sinks setting.
+	slackSinkName  = "slack"
+	stdoutSinkName = "stdout"
+
+	SINK_TYPE__MARKDOWN = "markdown"
+	SINK_TYPE__HTML     = "html"
+	SINK_TYPE__WEBHOOK  = "webhook"
+
+	// Where relative sink paths go. Files in the data directory itself are taken for emoji dumps.
+	reportsDir = "reports/"
+)
+
+// SinkMessage is one message of a report.
+type SinkMessage struct {
+	Type MessageType
+	// The message as plain text, in Slack's mrkdwn format.
+	Text string
+	// The Block Kit layout of the message, if it has one.
+	Blocks []slack.Block
+	// The ID that Send returned for the message that this one replies to, or empty.
+	ThreadID string
+	// Set when a resumed run sends a message again that the failed try of the run sent already.
+	Resent bool
+}
+
+// Sink is somewhere that reports go, like Slack, a file or a webhook.
+type Sink interface {
+	// Send delivers the message and returns an ID to reply to it with, or an empty string.
+	Send(message *SinkMessage) (string, error)
+	// Finish is called at the end of every report, with ok false if the report failed part way.
+	Finish(ok bool) error
+}
+
+// SinkConfig is a sink from the config file.
+type SinkConfig struct {
+	// markdown, html or webhook.
+	Type string `json:"type"`
+	// The file that markdown and html write the last report to. A relative path is in the reports directory of
+	// the data directory.
+	Path string `json:"path"`
+	// Where webhook posts every message as JSON.
+	URL string `json:"url"`
+	// The run modes in which the sink gets messages. Defaults to full_send, so that reviews and tests
+	// are not published.
+	RunModes []Mode `json:"run_modes"`
+}
+
+func (c *SinkConfig) validate(name string) error {
+	if name == slackSinkName || name == stdoutSinkName {
+		return fmt.Errorf("sink %q is built in and can not be configured", name)
+	}
+	switch c.Type {
+	case SINK_TYPE__MARKDOWN, SINK_TYPE__HTML:
+		if c.Path == "" {
+			return fmt.Errorf("sink %v needs a path", name)
+		}
+	case SINK_TYPE__WEBHOOK:
+		if !strings.HasPrefix(c.URL, "https://") && !strings.HasPrefix(c.URL, "http://") {
+			return fmt.Errorf("sink %v needs a url", name)
+		}
+	default:
+		return fmt.Errorf("sink %v has unknown type %q, expected markdown, html or webhook", name, c.Type)
+	}
+	return nil
+}
+
+// WithSink adds a sink, or replaces the one with the same name from the config. Routes refer to it by name.
+func WithSink(name string, sink Sink) Option {
+	return func(b *Bot) { b.sinks[name] = sink }
+}
+
+// newSinks makes the built in sinks and the ones from the config.
+func (b *Bot) newSinks() map[string]Sink {
+	sinks := map[string]Sink{
+		slackSinkName:  &slackSink{b: b},
+		stdoutSinkName: &stdoutSink{b: b},
+	}
+	for name, conf := range b.config.Sinks {
+		path := conf.Path
+		if path != "" && !filepath.IsAbs(path) {
+			path = b.dataDir + reportsDir + path
+		}
+		title := "Emoji Report"
+		if b.config.Name != "" {
+			title += " for " + b.config.Name
+		}
+		switch conf.Type {
+		case SINK_TYPE__MARKDOWN:
+			sinks[name] = &fileSink{path: path, title: title, clock: b.clock, format: markdownFormat{}}
+		case SINK_TYPE__HTML:
+			sinks[name] = &fileSink{path: path, title: title, clock: b.clock, format: htmlFormat{}}
+		case SINK_TYPE__WEBHOOK:
+			sinks[name] = &webhookSink{url: conf.URL, workspace: b.config.Name, client: &http.Client{Timeout: 30 * time.Second}}
+		}
+	}
+	return sinks
+}
+
+// routes returns the names of the sinks that get messages of the type.
+func (b *Bot) routes(level MessageType) []string {
+	if names, ok := b.config.Routes[level.String()]; ok {
+		return names
+	}
+	return []string{slackSinkName}
+}
+
+// sinkRunsNow is false for a sink from the config that is not used in this run mode.
+func (b *Bot) sinkRunsNow(name string) bool {
+	conf, ok := b.config.Sinks[name]
+	if !ok {
+		return true
+	}
+	modes := conf.RunModes
+	if len(modes) == 0 {
+		modes = []Mode{MODE__FULL_SEND}
+	}
+	runMode := b.config.RunMode
+	if b.approving {
+		runMode = MODE__FULL_SEND
+	}
+	for _, mode := range modes {
+		if mode == runMode {
+			return true
+		}
+	}
+	return false
+}
+
+// report runs one report, and then tells the sinks that it is done. In print_everything mode, it also
+// writes the transcript of the report, and with interactive_review, it asks the reviewers to approve it.
+func (b *Bot) report(name string, run func() error) error {
+	if b.config.RunMode == MODE__PRINT_EVERYTHING || b.reviewsInteractively() {
+		b.transcript = newTranscript()
+		defer func() { b.transcript = nil }()
+	}
+	err := run()
+	if err == nil {
+		err = b.writeTranscript(name)
+	}
+	if err == nil && b.reviewsInteractively() {
+		err = b.startReview(name, run)
+	}
+	finishErr := b.finishSinks(err == nil)
+	if err != nil {
+		return err
+	}
+	return finishErr
+}
+
+// finishSinks tells every sink that the report is done.
+func (b *Bot) finishSinks(ok bool) error {
+	var finishErrors []string
+	for name, sink := range b.sinks {
+		err := sink.Finish(ok)
+		if err != nil {
+			finishErrors = append(finishErrors, fmt.Sprintf("sink %v: %v", name, err))
+		}
+	}
+	if len(finishErrors) > 0 {
+		return errors.New(strings.Join(finishErrors, ", "))
+	}
+	return nil
+}
+
+// slackSink posts, DMs or prints messages like run_mode says.
+type slackSink struct {
+	b *Bot
+}
+
+func (s *slackSink) Send(message *SinkMessage) (string, error) {
+	return s.b.sendToSlack(message.Type, &renderedMessage{text: message.Text, blocks: message.Blocks}, message.ThreadID)
+}
+
+func (s *slackSink) Finish(ok bool) error {
+	return nil
+}
+
+type stdoutSink struct {
+	b *Bot
+}
+
+func (s *stdoutSink) Send(message *SinkMessage) (string, error) {
+	s.b.print(plainMessage(message.Text))
+	return "", nil
+}
+
+func (s *stdoutSink) Finish(ok bool) error {
+	return nil
+}
+
+// fileSink collects the messages of a report, and writes them to a file when the report is done.
+// The file always has the last report that finished, so that a wiki or a web server can show it.
+type fileSink struct {
+	path   string
+	title  string
+	clock  Clock
+	format fileFormat
+
+	messages []*SinkMessage
+}
+
+type fileFormat interface {
+	page(title string, messages []*SinkMessage) []byte
+}
+
+func (s *fileSink) Send(message *SinkMessage) (string, error) {
+	s.messages = append(s.messages, message)
+	// Replies only need to know that they are replies, so any ID that is not empty works.
+	return fmt.Sprint(len(s.messages)), nil
+}
+
+func (s *fileSink) Finish(ok bool) error {
+	messages := s.messages
+	s.messages = nil
+	if !ok || len(messages) == 0 {
+		return nil
+	}
+	err := ensureDirExists(filepath.Dir(s.path))
+	if err != nil {
+		return err
+	}
+	title := s.title + ", " + s.clock.Now().Format("January 2, 2006")
+	return writeFileAtomic(s.path, s.format.page(title, messages))
+}
+
+var (
+	slackBoldRegex    = regexp.MustCompile(`(^|[\s(])\*([^*\n]+)\*`)
+	slackMentionRegex = regexp.MustCompile(`<[@#]([A-Z0-9]+)(\|([^>]+))?>`)
+	slackLinkRegex    = regexp.MustCompile(`<(https?://[^|>]+)\|([^>]+)>`)
+	markdownLinkRegex = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)]+)\)`)
+	markdownBoldRegex = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+)
+
+// slackToMarkdown turns Slack's mrkdwn into Markdown: bold, mentions and links are written differently.
+func slackToMarkdown(text string) string {
+	text = slackLinkRegex.ReplaceAllString(text, "[$2]($1)")
+	text = slackMentionRegex.ReplaceAllStringFunc(text, func(mention string) string {
+		parts := slackMentionRegex.FindStringSubmatch(mention)
+		if parts[3] != "" {
+			return "@" + parts[3]
+		}
+		return "@" + parts[1]
+	})
+	return slackBoldRegex.ReplaceAllString(text, "$1**$2**")
+}
+
+type markdownFormat struct{}
+
+func (markdownFormat) page(title string, messages []*SinkMessage) []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "# %s\n", title)
+	for _, message := range messages {
+		var lines []string
+		if len(message.Blocks) == 0 {
+			lines = append(lines, slackToMarkdown(message.Text))
+		}
+		for _, block := range message.Blocks {
+			switch block := block.(type) {
+			case *slack.HeaderBlock:
+				lines = append(lines, "## "+block.Text.Text)
+			case *slack.SectionBlock:
+				lines = append(lines, slackToMarkdown(block.Text.Text))
+			case *slack.ContextBlock:
+				for _, element := range block.ContextElements.Elements {
+					if text, ok := element.(*slack.TextBlockObject); ok {
+						lines = append(lines, "_"+strings.TrimSpace(slackToMarkdown(text.Text))+"_")
+					}
+				}
+			case *slack.DividerBlock:
+				lines = append(lines, "---")
+			}
+		}
+		text := strings.Join(lines, "\n\n")
+		if message.ThreadID != "" {
+			// Replies are quoted under the message that they reply to.
+			text = "> " + strings.ReplaceAll(text, "\n", "\n> ")
+		}
+		// Markdown needs two spaces at the end of a line to keep a single new line.
+		fmt.Fprintf(&out, "\n%s\n", strings.ReplaceAll(text, "\n", "  \n"))
+	}
+	return out.Bytes()
+}
+
+type htmlFormat struct{}
+
+// slackToHTML escapes the text and turns Slack's mrkdwn into HTML.
+func slackToHTML(text string) string {
+	text = slackToMarkdown(text)
+	text = html.EscapeString(text)
+	text = markdownLinkRegex.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	text = markdownBoldRegex.ReplaceAllString(text, "<strong>$1</strong>")
+	return strings.ReplaceAll(text, "\n", "<br>\n")
+}
+
+func (htmlFormat) page(title string, messages []*SinkMessage) []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n",
+		html.EscapeString(title), html.EscapeString(title))
+	for _, message := range messages {
+		if message.ThreadID != "" {
+			out.WriteString("<blockquote>\n")
+		}
+		if len(message.Blocks) == 0 {
+			fmt.Fprintf(&out, "<p>%s</p>\n", slackToHTML(message.Text))
+		}
+		for _, block := range message.Blocks {
+			switch block := block.(type) {
+			case *slack.HeaderBlock:
+				fmt.Fprintf(&out, "<h2>%s</h2>\n", html.EscapeString(block.Text.Text))
+			case *slack.SectionBlock:
+				fmt.Fprintf(&out, "<p>%s</p>\n", slackToHTML(block.Text.Text))
+			case *slack.ContextBlock:
+				for _, element := range block.ContextElements.Elements {
+					if text, ok := element.(*slack.TextBlockObject); ok {
+						fmt.Fprintf(&out, "<p><small>%s</small></p>\n", slackToHTML(text.Text))
+					}
+				}
+			case *slack.DividerBlock:
+				out.WriteString("<hr>\n")
+			}
+		}
+		if message.ThreadID != "" {
+			out.WriteString("</blockquote>\n")
+		}
+	}
+	out.WriteString("</body>\n</html>\n")
+	return out.Bytes()
+}
+
+// webhookSink posts every message as JSON to a URL, as soon as it is sent.
+type webhookSink struct {
+	url       string
+	workspace string
+	client    *http.Client
+}
+
+type webhookMessage struct {
+	Workspace string        `json:"workspace,omitempty"`
+	Type      string        `json:"type"`
+	Text      string        `json:"text"`
+	Blocks    []slack.Block `json:"blocks,omitempty"`
+	Reply     bool          `json:"reply"`
+}
+
+func (s *webhookSink) Send(message *SinkMessage) (string, error) {
+	if message.Resent {
+		// The failed try of the run sent it already.
+		return "", nil
+	}
+	body, err := json.Marshal(&webhookMessage{
+		Workspace: s.workspace,
+		Type:      message.Type.String(),
+		Text:      message.Text,
+		Blocks:    message.Blocks,
+		Reply:     message.ThreadID != "",
+	})
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("webhook returned %v", resp.Status)
+	}
+	return "", nil
+}
+
+func (s *webhookSink) Finish(ok bool) error {
+	return nil
+}
+
+// writeFileAtomic writes to a temporary file first, so that a crash can not leave a half written file.
+func writeFileAtomic(fileName string, contents []byte) error {
+	err := ioutil.WriteFile(fileName+".tmp", contents, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(fileName+".tmp", fileName)
+}
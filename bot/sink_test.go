@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingSink struct {
+	messages []*SinkMessage
+	finished []bool
+}
+
+func (s *recordingSink) Send(message *SinkMessage) (string, error) {
+	s.messages = append(s.messages, message)
+	return "", nil
+}
+
+func (s *recordingSink) Finish(ok bool) error {
+	s.finished = append(s.finished, ok)
+	return nil
+}
+
+func TestRoutesSendMessageTypesToSinks(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-emoji", "U2", time.Hour)
+	sink := &recordingSink{}
+	b.sinks["recorder"] = sink
+	b.config.Routes = map[string][]string{
+		"send":            {"slack", "recorder"},
+		"send_and_review": {"recorder"},
+	}
+
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.finished) != 1 || !sink.finished[0] {
+		t.Errorf("got Finish calls %v, want one with ok", sink.finished)
+	}
+	var grid, prompt bool
+	for _, message := range sink.messages {
+		switch {
+		case message.Type == MSG_TYPE__SEND_AND_REVIEW && strings.Contains(message.Text, ":new-emoji:"):
+			grid = true
+		case message.Type == MSG_TYPE__SEND && message.Text == votePrompt:
+			prompt = true
+		case message.Type != MSG_TYPE__SEND && message.Type != MSG_TYPE__SEND_AND_REVIEW:
+			t.Errorf("the sink got a %v message, which is not routed to it", message.Type)
+		}
+	}
+	if !grid || !prompt {
+		t.Errorf("the sink did not get the grid (%v) or the vote prompt (%v)", grid, prompt)
+	}
+
+	// The grid only went to the recorder, so only the vote prompt and its thread are in the channel.
+	for _, text := range postedTo(server, b.config.EmojiChannel) {
+		if strings.Contains(text, "Here are all the new emojis") {
+			t.Errorf("the grid was posted to Slack: %q", text)
+		}
+	}
+	findPosted(t, postedTo(server, b.config.EmojiChannel), votePrompt)
+}
+
+func TestMarkdownSinkWritesFinishedReports(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-emoji", "U2", time.Hour)
+	b.config.Sinks = map[string]*SinkConfig{"wiki": {Type: SINK_TYPE__MARKDOWN, Path: "report.md"}}
+	b.config.Routes = map[string][]string{"send": {"slack", "wiki"}, "send_and_review": {"slack", "wiki"}}
+	b.sinks = b.newSinks()
+	path := filepath.Join(b.dataDir, reportsDir, "report.md")
+
+	err := b.report("test", func() error {
+		_, err := b.printMessage(MSG_TYPE__SEND, "half a report")
+		if err != nil {
+			return err
+		}
+		return errors.New("failed")
+	})
+	if err == nil {
+		t.Fatal("expected the error of the report")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("a failed report was written: %v", err)
+	}
+
+	err = b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(contents)
+	for _, want := range []string{"# Emoji Report", ":new-emoji:", "**Vote for the best new emoji", "> :new-emoji: new-emoji"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("the report does not have %q:\n%v", want, page)
+		}
+	}
+	if strings.Contains(page, "half a report") {
+		t.Errorf("the report has a message of the failed report:\n%v", page)
+	}
+}
+
+func TestSinksOnlyRunInTheirRunModes(t *testing.T) {
+	b, _ := setupWeekly(t)
+	b.config.Sinks = map[string]*SinkConfig{
+		"wiki":  {Type: SINK_TYPE__MARKDOWN, Path: "report.md"},
+		"draft": {Type: SINK_TYPE__MARKDOWN, Path: "draft.md", RunModes: []Mode{MODE__DM_FOR_REVIEW}},
+	}
+	for _, test := range []struct {
+		mode        Mode
+		wiki, draft bool
+	}{
+		{MODE__FULL_SEND, true, false},
+		{MODE__DM_FOR_REVIEW, false, true},
+		{MODE__PRINT_EVERYTHING, false, false},
+	} {
+		b.config.RunMode = test.mode
+		if b.sinkRunsNow("wiki") != test.wiki || b.sinkRunsNow("draft") != test.draft {
+			t.Errorf("in %v got wiki %v and draft %v, want %v and %v",
+				test.mode, b.sinkRunsNow("wiki"), b.sinkRunsNow("draft"), test.wiki, test.draft)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// How many times a call is tried before giving up.
+	maxAttempts = 6
+	// The wait before the first retry of a failed call. It doubles with every retry, up to maxRetryDelay.
+	firstRetryDelay = time.Second
+	maxRetryDelay   = time.Minute
+)
+
+// rateLimit is how often a Slack method may be called, see https://api.slack.com/docs/rate-limits.
+// Short bursts above the limit are allowed.
+type rateLimit struct {
+	perMinute int
+	burst     int
+	// Calls that change something, like posting a message, are only retried when Slack says that
+	// the call was rate limited. After a server error or a dropped connection, the call may have
+	// gone through, and retrying it could post the same message twice.
+	changesSomething bool
+}
+
+var methodLimits = map[string]rateLimit{
+	// Posting is limited to about one message per second per channel.
+	"chat.postMessage": {perMinute: 60, burst: 10, changesSomething: true},
+	// Changing a message again does no harm, so these are retried like reads.
+	"chat.update":           {perMinute: 50, burst: 10},  // Tier 3
+	"chat.delete":           {perMinute: 50, burst: 10},  // Tier 3
+	"conversations.list":    {perMinute: 20, burst: 5},   // Tier 2
+	"conversations.history": {perMinute: 50, burst: 10},  // Tier 3
+	"users.info":            {perMinute: 100, burst: 20}, // Tier 4
+	"emoji.list":            {perMinute: 20, burst: 5},   // Tier 2
+	// A trigger ID can only open one modal, and only for a few seconds.
+	"views.open": {perMinute: 100, burst: 20, changesSomething: true}, // Tier 4
+	// Not documented, so assume the same as emoji.list.
+	"emoji.adminList": {perMinute: 20, burst: 5},
+}
+
+// retrier makes the calls to Slack. It keeps each method under its rate limit, and retries calls
+// that were rate limited or failed because of a server error or a network error.
+type retrier struct {
+	out   io.Writer
+	sleep func(time.Duration)
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRetrier(out io.Writer, clock Clock) *retrier {
+	return &retrier{
+		out:     out,
+		sleep:   time.Sleep,
+		now:     clock.Now,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// do calls the Slack method, waiting for its rate limit and retrying it when that can help.
+// A nil retrier just calls it.
+func (r *retrier) do(method string, call func() error) error {
+	if r == nil {
+		return call()
+	}
+	limit, ok := methodLimits[method]
+	var err error
+	for attempt := 1; ; attempt++ {
+		if ok {
+			r.sleep(r.reserve(method, limit))
+		}
+		err = call()
+		if err == nil {
+			return nil
+		}
+		wait, retryable := retryDelay(err, attempt, limit.changesSomething)
+		if !retryable {
+			return err
+		}
+		if attempt == maxAttempts {
+			return fmt.Errorf("%v failed %d times: %w", method, attempt, err)
+		}
+		fmt.Fprintf(r.out, "%v failed, retrying in %v: %v\n", method, wait.Round(time.Millisecond), err)
+		r.sleep(wait)
+	}
+}
+
+// reserve takes a call from the rate limit of the method and returns how long to wait before making it.
+func (r *retrier) reserve(method string, limit rateLimit) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bucket, ok := r.buckets[method]
+	if !ok {
+		bucket = &tokenBucket{limit: limit}
+		r.buckets[method] = bucket
+	}
+	return bucket.reserve(r.now())
+}
+
+// retryDelay says if a failed call should be retried, and after how long.
+func retryDelay(err error, attempt int, changesSomething bool) (time.Duration, bool) {
+	var rateLimited *slack.RateLimitedError
+	if errors.As(err, &rateLimited) {
+		// Slack says how long to wait. Some jitter keeps callers that were limited together from coming back together.
+		return rateLimited.RetryAfter + time.Duration(rand.Int63n(int64(500*time.Millisecond))), true
+	}
+	if changesSomething || !isTemporary(err) {
+		return 0, false
+	}
+	delay := firstRetryDelay << (attempt - 1)
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	// Wait between half and all of the delay.
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2))), true
+}
+
+// isTemporary is true for errors that may go away when the call is tried again.
+func isTemporary(err error) bool {
+	var statusError interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusError) {
+		return statusError.HTTPStatusCode() >= 500
+	}
+	var slackError slack.SlackErrorResponse
+	if errors.As(err, &slackError) {
+		switch slackError.Err {
+		case "ratelimited", "internal_error", "fatal_error", "service_unavailable", "request_timeout":
+			return true
+		}
+		return false
+	}
+	var netError net.Error
+	return errors.As(err, &netError) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// tokenBucket allows burst calls at once, and then perMinute calls a minute.
+type tokenBucket struct {
+	limit  rateLimit
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token and returns how long to wait until it is there.
+func (t *tokenBucket) reserve(now time.Time) time.Duration {
+	perSecond := float64(t.limit.perMinute) / 60
+	if t.last.IsZero() {
+		t.tokens = float64(t.limit.burst)
+	} else if now.After(t.last) {
+		t.tokens += now.Sub(t.last).Seconds() * perSecond
+		if t.tokens > float64(t.limit.burst) {
+			t.tokens = float64(t.limit.burst)
+		}
+	}
+	if now.After(t.last) {
+		t.last = now
+	}
+	t.tokens--
+	if t.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-t.tokens / perSecond * float64(time.Second))
+}
+
+// httpStatusError is a response from Slack that was not a 200, for calls that are not made with the Slack client.
+type httpStatusError struct {
+	code   int
+	status string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("slack server error: %s", e.status)
+}
+
+func (e *httpStatusError) HTTPStatusCode() int {
+	return e.code
+}
+
+// checkStatusCode turns a response that was not a 200 into an error, the same way the Slack client does.
+func checkStatusCode(resp *http.Response) error {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err != nil {
+			seconds = 1
+		}
+		return &slack.RateLimitedError{RetryAfter: time.Duration(seconds) * time.Second}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &httpStatusError{code: resp.StatusCode, status: resp.Status}
+	}
+	return nil
+}
+
+// retryingClient is a SlackClient that makes every call with a retrier.
+type retryingClient struct {
+	client  SlackClient
+	retrier *retrier
+}
+
+func (c *retryingClient) PostMessage(channelID string, options ...slack.MsgOption) (channel string, timestamp string, err error) {
+	err = c.retrier.do("chat.postMessage", func() error {
+		channel, timestamp, err = c.client.PostMessage(channelID, options...)
+		return err
+	})
+	return channel, timestamp, err
+}
+
+func (c *retryingClient) UpdateMessage(channelID, timestamp string, options ...slack.MsgOption) (channel string, ts string, text string, err error) {
+	err = c.retrier.do("chat.update", func() error {
+		channel, ts, text, err = c.client.UpdateMessage(channelID, timestamp, options...)
+		return err
+	})
+	return channel, ts, text, err
+}
+
+func (c *retryingClient) DeleteMessage(channelID, timestamp string) (channel string, ts string, err error) {
+	err = c.retrier.do("chat.delete", func() error {
+		channel, ts, err = c.client.DeleteMessage(channelID, timestamp)
+		return err
+	})
+	return channel, ts, err
+}
+
+func (c *retryingClient) GetConversations(params *slack.GetConversationsParameters) (channels []slack.Channel, cursor string, err error) {
+	err = c.retrier.do("conversations.list", func() error {
+		channels, cursor, err = c.client.GetConversations(params)
+		return err
+	})
+	return channels, cursor, err
+}
+
+func (c *retryingClient) GetConversationHistory(params *slack.GetConversationHistoryParameters) (history *slack.GetConversationHistoryResponse, err error) {
+	err = c.retrier.do("conversations.history", func() error {
+		history, err = c.client.GetConversationHistory(params)
+		return err
+	})
+	return history, err
+}
+
+func (c *retryingClient) GetUsersInfo(users ...string) (usersInfo *[]slack.User, err error) {
+	err = c.retrier.do("users.info", func() error {
+		usersInfo, err = c.client.GetUsersInfo(users...)
+		return err
+	})
+	return usersInfo, err
+}
+
+func (c *retryingClient) GetEmoji() (emojis map[string]string, err error) {
+	err = c.retrier.do("emoji.list", func() error {
+		emojis, err = c.client.GetEmoji()
+		return err
+	})
+	return emojis, err
+}
+
+func (c *retryingClient) OpenView(triggerID string, view slack.ModalViewRequest) (response *slack.ViewResponse, err error) {
+	err = c.retrier.do("views.open", func() error {
+		response, err = c.client.OpenView(triggerID, view)
+		return err
+	})
+	return response, err
+}
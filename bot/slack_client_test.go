@@ -0,0 +1,145 @@
+package bot
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func testRetrier() (*retrier, *[]time.Duration) {
+	clock := &fakeClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var slept []time.Duration
+	r := newRetrier(io.Discard, clock)
+	r.sleep = func(d time.Duration) {
+		if d > 0 {
+			slept = append(slept, d)
+			clock.now = clock.now.Add(d)
+		}
+	}
+	return r, &slept
+}
+
+func TestRetrierRetries(t *testing.T) {
+	serverError := &httpStatusError{code: http.StatusBadGateway, status: "502 Bad Gateway"}
+	for _, test := range []struct {
+		name      string
+		method    string
+		errors    []error
+		wantCalls int
+		wantError bool
+	}{
+		{
+			name:      "rate limited",
+			method:    "chat.postMessage",
+			errors:    []error{&slack.RateLimitedError{RetryAfter: time.Second}},
+			wantCalls: 2,
+		},
+		{
+			name:      "server error when reading",
+			method:    "conversations.history",
+			errors:    []error{serverError, serverError},
+			wantCalls: 3,
+		},
+		{
+			name:      "server error when posting",
+			method:    "chat.postMessage",
+			errors:    []error{serverError},
+			wantCalls: 1,
+			wantError: true,
+		},
+		{
+			name:      "slack error",
+			method:    "conversations.history",
+			errors:    []error{slack.SlackErrorResponse{Err: "channel_not_found"}},
+			wantCalls: 1,
+			wantError: true,
+		},
+		{
+			name:      "temporary slack error",
+			method:    "users.info",
+			errors:    []error{slack.SlackErrorResponse{Err: "internal_error"}},
+			wantCalls: 2,
+		},
+		{
+			name:      "gives up",
+			method:    "conversations.list",
+			errors:    []error{io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF},
+			wantCalls: maxAttempts,
+			wantError: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := testRetrier()
+			calls := 0
+			err := r.do(test.method, func() error {
+				calls++
+				if calls <= len(test.errors) {
+					return test.errors[calls-1]
+				}
+				return nil
+			})
+			if calls != test.wantCalls {
+				t.Errorf("got %d calls, want %d", calls, test.wantCalls)
+			}
+			if (err != nil) != test.wantError {
+				t.Errorf("got error %v, want error: %v", err, test.wantError)
+			}
+			if err != nil && !strings.Contains(err.Error(), test.errors[len(test.errors)-1].Error()) {
+				t.Errorf("the error %v does not wrap the last error", err)
+			}
+		})
+	}
+}
+
+func TestRetrierBacksOff(t *testing.T) {
+	r, slept := testRetrier()
+	calls := 0
+	_ = r.do("conversations.list", func() error {
+		calls++
+		return &httpStatusError{code: http.StatusServiceUnavailable}
+	})
+	if len(*slept) != maxAttempts-1 {
+		t.Fatalf("got waits %v, want %d", *slept, maxAttempts-1)
+	}
+	for i, wait := range *slept {
+		delay := firstRetryDelay << i
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+		if wait < delay/2 || wait > delay {
+			t.Errorf("wait %d was %v, want between %v and %v", i, wait, delay/2, delay)
+		}
+	}
+}
+
+func TestRetrierKeepsToRateLimit(t *testing.T) {
+	r, slept := testRetrier()
+	limit := methodLimits["conversations.list"]
+	for i := 0; i < limit.burst+3; i++ {
+		err := r.do("conversations.list", func() error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(*slept) != 3 {
+		t.Fatalf("expected to wait after the first %d calls, got waits %v", limit.burst, *slept)
+	}
+	between := time.Minute / time.Duration(limit.perMinute)
+	for _, wait := range *slept {
+		if wait < between-time.Millisecond || wait > between+time.Millisecond {
+			t.Errorf("waited %v between calls, want %v", wait, between)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package bot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The layout of time.Time.String, which is how snapshots are named.
+const snapshotTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// snapshotDiff is what changed between two emoji snapshots. Each list is sorted by name.
+type snapshotDiff struct {
+	Added   []*Emoji
+	Deleted []*Emoji
+	// Emojis whose image changed.
+	Reuploaded []*emojiChange
+	// A deleted emoji and a new emoji with the same image.
+	Renamed        []*emojiChange
+	AliasesAdded   []*Emoji
+	AliasesRemoved []*Emoji
+	// Aliases for another emoji now, or emojis that became or stopped being an alias.
+	Realiased []*emojiChange
+}
+
+type emojiChange struct {
+	Old *Emoji
+	New *Emoji
+}
+
+func (d *snapshotDiff) empty() bool {
+	return len(d.Added)+len(d.Deleted)+len(d.Reuploaded)+len(d.Renamed)+
+		len(d.AliasesAdded)+len(d.AliasesRemoved)+len(d.Realiased) == 0
+}
+
+// diffSnapshots compares two snapshots. sameImage tells whether two emojis have the same image.
+func diffSnapshots(before, after *SlackEmojiResponseMessage, sameImage func(a, b *Emoji) bool) *snapshotDiff {
+	oldEmojis := make(map[string]*Emoji, len(before.Emoji))
+	for _, emoji := range before.Emoji {
+		oldEmojis[emoji.Name] = emoji
+	}
+	newEmojis := make(map[string]*Emoji, len(after.Emoji))
+	for _, emoji := range after.Emoji {
+		newEmojis[emoji.Name] = emoji
+	}
+
+	diff := &snapshotDiff{}
+	var added, deleted []*Emoji
+	for _, emoji := range after.Emoji {
+		previous, ok := oldEmojis[emoji.Name]
+		switch {
+		case !ok:
+			added = append(added, emoji)
+		case previous.AliasFor != emoji.AliasFor:
+			diff.Realiased = append(diff.Realiased, &emojiChange{Old: previous, New: emoji})
+		case emoji.AliasFor == "" && previous.Url != emoji.Url && !sameImage(previous, emoji):
+			diff.Reuploaded = append(diff.Reuploaded, &emojiChange{Old: previous, New: emoji})
+		}
+	}
+	for _, emoji := range before.Emoji {
+		if _, ok := newEmojis[emoji.Name]; !ok {
+			deleted = append(deleted, emoji)
+		}
+	}
+	sort.Sort(emojiNameSort(added))
+	sort.Sort(emojiNameSort(deleted))
+
+	renamedTo := map[string]bool{}
+	for _, gone := range deleted {
+		if gone.AliasFor != "" {
+			diff.AliasesRemoved = append(diff.AliasesRemoved, gone)
+			continue
+		}
+		var match *Emoji
+		for _, emoji := range added {
+			if emoji.AliasFor == "" && !renamedTo[emoji.Name] && sameImage(gone, emoji) {
+				match = emoji
+				break
+			}
+		}
+		if match == nil {
+			diff.Deleted = append(diff.Deleted, gone)
+			continue
+		}
+		renamedTo[match.Name] = true
+		diff.Renamed = append(diff.Renamed, &emojiChange{Old: gone, New: match})
+	}
+	for _, emoji := range added {
+		if emoji.AliasFor != "" {
+			diff.AliasesAdded = append(diff.AliasesAdded, emoji)
+		} else if !renamedTo[emoji.Name] {
+			diff.Added = append(diff.Added, emoji)
+		}
+	}
+	sort.Slice(diff.Reuploaded, func(i, j int) bool { return diff.Reuploaded[i].New.Name < diff.Reuploaded[j].New.Name })
+	sort.Slice(diff.Realiased, func(i, j int) bool { return diff.Realiased[i].New.Name < diff.Realiased[j].New.Name })
+	return diff
+}
+
+type emojiNameSort []*Emoji
+
+func (p emojiNameSort) Len() int           { return len(p) }
+func (p emojiNameSort) Less(i, j int) bool { return p[i].Name < p[j].Name }
+func (p emojiNameSort) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// RunDiff reports what changed between two emoji snapshots. from and to are the file name of a snapshot, or a
+// date or an age, for the newest snapshot at that time. to can also be "now", to download every emoji. By
+// default, the last snapshot is compared with the one before it. The changes are DMed to the reviewers, or
+// written to outputPath as Markdown, or HTML if its name ends in .html.
+func (b *Bot) RunDiff(from, to, outputPath string) error {
+	return b.report("diff", func() error {
+		fromOffset := 1
+		if to == "now" {
+			// Downloading the emojis can save a snapshot, which is not the one to compare them with.
+			fromOffset = 0
+		}
+		before, beforeName, err := b.loadSnapshot(from, fromOffset)
+		if err != nil {
+			return err
+		}
+		after, afterName, err := b.loadSnapshot(to, 0)
+		if err != nil {
+			return err
+		}
+		sameImage, err := b.imageComparer()
+		if err != nil {
+			return err
+		}
+		diff := diffSnapshots(before, after, sameImage)
+		messages := renderSnapshotDiff(fmt.Sprintf("Emoji changes from %v to %v", beforeName, afterName), diff)
+		if outputPath == "" {
+			_, err = b.printMessages(MSG_TYPE__DM_ONLY, messages, "")
+			return err
+		}
+		return b.writeReportFile(outputPath, "Emoji Changes", MSG_TYPE__DM_ONLY, messages)
+	})
+}
+
+// loadSnapshot loads the snapshot that spec names, see RunDiff, and describes it. An empty spec is the
+// snapshot that is offset from the newest one.
+func (b *Bot) loadSnapshot(spec string, offset int) (*SlackEmojiResponseMessage, string, error) {
+	if spec == "now" {
+		// Not read from the history, since the emojis that were deleted are only known after a full download.
+		emojis, err := b.getAllEmojis()
+		return emojis, "now", err
+	}
+	names, err := b.emojiSnapshots()
+	if err != nil {
+		return nil, "", err
+	}
+	var name string
+	switch {
+	case spec == "":
+		if len(names) <= offset {
+			return nil, "", fmt.Errorf("there are %v emoji snapshots, which is not enough to compare", len(names))
+		}
+		name = names[len(names)-1-offset]
+	case fileExists(b.dataDir + spec):
+		name = spec
+	case fileExists(spec):
+		contents, err := ioutil.ReadFile(spec)
+		if err != nil {
+			return nil, "", err
+		}
+		snapshot, err := parseEmojiResponse(contents)
+		return snapshot, path.Base(spec), err
+	default:
+		location, err := b.config.Location()
+		if err != nil {
+			return nil, "", err
+		}
+		at, err := ParseCutoff(spec, b.now(), location)
+		if err != nil {
+			return nil, "", fmt.Errorf("%q is not a snapshot: %w", spec, err)
+		}
+		for _, snapshot := range names {
+			taken, ok := snapshotTime(snapshot)
+			if ok && !taken.After(at) {
+				name = snapshot
+			}
+		}
+		if name == "" {
+			return nil, "", fmt.Errorf("there is no emoji snapshot from before %v", at.Format("2006-01-02 15:04"))
+		}
+	}
+	contents, err := ioutil.ReadFile(b.dataDir + name)
+	if err != nil {
+		return nil, "", err
+	}
+	snapshot, err := parseEmojiResponse(contents)
+	if err != nil {
+		return nil, "", err
+	}
+	description := name
+	if taken, ok := snapshotTime(name); ok {
+		description = taken.Format("2006-01-02 15:04")
+	}
+	return snapshot, description, nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// snapshotTime is when the snapshot with the file name was taken.
+func snapshotTime(name string) (time.Time, bool) {
+	name = strings.TrimSuffix(name, ".json")
+	// Times from the clock of the process have a monotonic reading at the end.
+	if i := strings.Index(name, " m="); i >= 0 {
+		name = name[:i]
+	}
+	taken, err := time.Parse(snapshotTimeLayout, name)
+	return taken, err == nil
+}
+
+// imageComparer returns a function that tells whether two emojis have the same image. That is the same hash
+// in the history when both images were downloaded, and otherwise the same file name in the URL, which Slack
+// keeps when an emoji is renamed.
+func (b *Bot) imageComparer() (func(a, b *Emoji) bool, error) {
+	hashes, err := b.imageHashesByUrl()
+	if err != nil {
+		return nil, err
+	}
+	return func(x, y *Emoji) bool {
+		if x.Url == "" || y.Url == "" {
+			return false
+		}
+		xHash, xOk := hashes[imageUrlKey(x.Url)]
+		yHash, yOk := hashes[imageUrlKey(y.Url)]
+		if xOk && yOk {
+			return xHash == yHash
+		}
+		return path.Base(x.Url) == path.Base(y.Url)
+	}, nil
+}
+
+// writeReportFile writes the messages to a Markdown file, or an HTML file if the path ends in .html.
+func (b *Bot) writeReportFile(outputPath, title string, level MessageType, messages []*renderedMessage) error {
+	sink := &fileSink{path: outputPath, title: title, clock: b.clock, format: markdownFormat{}}
+	if strings.HasSuffix(outputPath, ".html") {
+		sink.format = htmlFormat{}
+	}
+	if b.config.Name != "" {
+		sink.title += " for " + b.config.Name
+	}
+	for _, message := range messages {
+		_, err := sink.Send(&SinkMessage{Type: level, Text: message.text, Blocks: message.blocks})
+		if err != nil {
+			return err
+		}
+	}
+	err := sink.Finish(true)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(b.out, "Wrote the report to %v\n", outputPath)
+	return nil
+}
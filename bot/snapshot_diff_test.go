@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func emojiNames(emojis []*Emoji) []string {
+	var names []string
+	for _, emoji := range emojis {
+		names = append(names, emoji.Name)
+	}
+	return names
+}
+
+func changeNames(changes []*emojiChange) []string {
+	var names []string
+	for _, change := range changes {
+		names = append(names, change.Old.Name+">"+change.New.Name)
+	}
+	return names
+}
+
+// diffTestSnapshots are two snapshots with one change of every kind.
+func diffTestSnapshots() (*SlackEmojiResponseMessage, *SlackEmojiResponseMessage) {
+	before := &SlackEmojiResponseMessage{Ok: true, Emoji: []*Emoji{
+		{Name: "kept", Url: "https://emoji.example.com/kept/aaa.png"},
+		{Name: "gone", Url: "https://emoji.example.com/gone/bbb.png"},
+		{Name: "redone", Url: "https://emoji.example.com/redone/ccc.png"},
+		{Name: "old-name", Url: "https://emoji.example.com/old-name/ddd.png"},
+		{Name: "moved-alias", IsAlias: 1, AliasFor: "kept"},
+		{Name: "same-alias", IsAlias: 1, AliasFor: "kept"},
+		{Name: "gone-alias", IsAlias: 1, AliasFor: "kept"},
+	}}
+	after := &SlackEmojiResponseMessage{Ok: true, Emoji: []*Emoji{
+		{Name: "kept", Url: "https://emoji.example.com/kept/aaa.png"},
+		{Name: "redone", Url: "https://emoji.example.com/redone/eee.png"},
+		{Name: "new-name", Url: "https://emoji.example.com/old-name/ddd.png"},
+		{Name: "brand-new", Url: "https://emoji.example.com/brand-new/fff.png"},
+		{Name: "moved-alias", IsAlias: 1, AliasFor: "redone"},
+		{Name: "same-alias", IsAlias: 1, AliasFor: "kept"},
+		{Name: "new-alias", IsAlias: 1, AliasFor: "brand-new"},
+	}}
+	return before, after
+}
+
+func TestDiffSnapshotsClassifiesChanges(t *testing.T) {
+	b, _ := setupWeekly(t)
+	sameImage, err := b.imageComparer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, after := diffTestSnapshots()
+	diff := diffSnapshots(before, after, sameImage)
+	for _, check := range []struct {
+		kind string
+		got  []string
+		want []string
+	}{
+		{"added", emojiNames(diff.Added), []string{"brand-new"}},
+		{"deleted", emojiNames(diff.Deleted), []string{"gone"}},
+		{"re-uploaded", changeNames(diff.Reuploaded), []string{"redone>redone"}},
+		{"renamed", changeNames(diff.Renamed), []string{"old-name>new-name"}},
+		{"new aliases", emojiNames(diff.AliasesAdded), []string{"new-alias"}},
+		{"removed aliases", emojiNames(diff.AliasesRemoved), []string{"gone-alias"}},
+		{"re-aliased", changeNames(diff.Realiased), []string{"moved-alias>moved-alias"}},
+	} {
+		if !reflect.DeepEqual(check.got, check.want) {
+			t.Errorf("got %v %v, want %v", check.kind, check.got, check.want)
+		}
+	}
+}
+
+func TestDiffComparesSnapshotsByDate(t *testing.T) {
+	b, _ := setupWeekly(t)
+	before, after := diffTestSnapshots()
+	weekAgo := b.now().Add(-7 * 24 * time.Hour)
+	for taken, snapshot := range map[time.Time]*SlackEmojiResponseMessage{weekAgo: before, b.now(): after} {
+		contents, err := json.Marshal(snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ensureDirExists(b.dataDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(b.dataDir+taken.String()+".json", contents, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := filepath.Join(t.TempDir(), "changes.md")
+	err := b.RunDiff("8d", "1d", output)
+	if err == nil || !strings.Contains(err.Error(), "no emoji snapshot from before") {
+		t.Errorf("expected no snapshot from before 8 days ago, got %v", err)
+	}
+	err = b.RunDiff("6d", "now", output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every emoji from the week old snapshot is gone from the fake Slack, which only has old-emoji.
+	for _, want := range []string{"Emoji changes from", "to now", "**New emojis (1):**", "old-emoji", "**Deleted emojis (4):**", "**Removed aliases (3):**"} {
+		if !strings.Contains(string(report), want) {
+			t.Errorf("the report does not have %q:\n%s", want, report)
+		}
+	}
+}
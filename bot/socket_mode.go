@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// listenForSocketModeEvents connects over Socket Mode and handles events until the context is done.
+func (b *Bot) listenForSocketModeEvents(ctx context.Context) error {
+	api := slack.New(b.config.BotOauthToken, slack.OptionAppLevelToken(b.config.AppToken))
+	client := socketmode.New(api)
+	go func() {
+		for evt := range client.Events {
+			switch evt.Type {
+			case socketmode.EventTypeConnected:
+				fmt.Fprintln(b.out, "Connected to Slack with Socket Mode")
+				b.setListening(true)
+			case socketmode.EventTypeConnecting, socketmode.EventTypeConnectionError, socketmode.EventTypeDisconnect:
+				// Events can be missed until it connects again.
+				b.setListening(false)
+			case socketmode.EventTypeEventsAPI:
+				client.Ack(*evt.Request)
+				eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
+				if !ok {
+					continue
+				}
+				switch event := eventsAPIEvent.InnerEvent.Data.(type) {
+				case *slackevents.EmojiChangedEvent:
+					err := b.handleEmojiChanged(event)
+					if err != nil {
+						fmt.Fprintf(b.out, "Unable to handle emoji_changed event: %v\n", err)
+					}
+				case *slackevents.ReactionAddedEvent:
+					err := b.handleReaction(event, false)
+					if err != nil {
+						fmt.Fprintf(b.out, "Unable to handle reaction_added event: %v\n", err)
+					}
+				case *slackevents.ReactionRemovedEvent:
+					err := b.handleReaction((*slackevents.ReactionAddedEvent)(event), true)
+					if err != nil {
+						fmt.Fprintf(b.out, "Unable to handle reaction_removed event: %v\n", err)
+					}
+				case *slackevents.MessageEvent:
+					err := b.handleDirectMessage(event)
+					if err != nil {
+						fmt.Fprintf(b.out, "Unable to handle direct message: %v\n", err)
+					}
+				}
+			case socketmode.EventTypeInteractive:
+				client.Ack(*evt.Request)
+				callback, ok := evt.Data.(slack.InteractionCallback)
+				if !ok {
+					continue
+				}
+				// Approving posts the whole preview, which should not hold up the other events.
+				go func() {
+					err := b.handleInteraction(&callback)
+					if err != nil {
+						fmt.Fprintf(b.out, "Unable to handle %v interaction: %v\n", callback.Type, err)
+					}
+				}()
+			case socketmode.EventTypeSlashCommand:
+				command, ok := evt.Data.(slack.SlashCommand)
+				if !ok {
+					client.Ack(*evt.Request)
+					continue
+				}
+				reply, err := b.handleUserCommand(command.UserID, command.Text)
+				if err != nil {
+					fmt.Fprintf(b.out, "Unable to handle slash command: %v\n", err)
+					reply = fmt.Sprintf(userCommandErrorMessage, b.config.OwnerLDAP)
+				}
+				client.Ack(*evt.Request, map[string]interface{}{"text": reply})
+			}
+		}
+	}()
+	defer b.setListening(false)
+	return client.RunContext(ctx)
+}
+
+func (b *Bot) setListening(listening bool) {
+	b.listeningLock.Lock()
+	defer b.listeningLock.Unlock()
+	if !listening {
+		b.listening = time.Time{}
+	} else if b.listening.IsZero() {
+		b.listening = b.now()
+	}
+}
+
+// listeningSince is when Socket Mode connected, or zero if it is not connected.
+func (b *Bot) listeningSince() time.Time {
+	b.listeningLock.Lock()
+	defer b.listeningLock.Unlock()
+	return b.listening
+}
@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	stateFile = "state.json"
+	// How many runs to keep in the state file.
+	maxRunsInState = 100
+)
+
+// botState is what the bot remembers between runs, so that the next run knows where to resume.
+type botState struct {
+	Runs []*runRecord `json:"runs"`
+}
+
+// runRecord is one weekly run that posted to emoji_channel.
+type runRecord struct {
+	// The ID of the journal of the run, see journal.go.
+	ID   string    `json:"id,omitempty"`
+	Time time.Time `json:"time"`
+	// The last emoji that was already posted before this run. Emojis after it were new in this run.
+	StartEmoji        string `json:"start_emoji"`
+	StartEmojiCreated int64  `json:"start_emoji_created"`
+	// The newest emoji that this run posted.
+	LastNewEmoji        string `json:"last_new_emoji"`
+	LastNewEmojiCreated int64  `json:"last_new_emoji_created"`
+	// Where the vote prompt was posted.
+	VoteChannelID string `json:"vote_channel_id,omitempty"`
+	VoteMessageTS string `json:"vote_message_ts,omitempty"`
+}
+
+func (b *Bot) statePath() string {
+	return b.dataDir + stateDir + stateFile
+}
+
+func (b *Bot) loadState() (*botState, error) {
+	state := &botState{}
+	contents, err := ioutil.ReadFile(b.statePath())
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(contents, state)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (s *botState) lastRun() *runRecord {
+	if len(s.Runs) == 0 {
+		return nil
+	}
+	return s.Runs[len(s.Runs)-1]
+}
+
+// recordRun adds the run to the state file.
+func (b *Bot) recordRun(run *runRecord) error {
+	state, err := b.loadState()
+	if err != nil {
+		return err
+	}
+	if last := state.lastRun(); last != nil && last.ID != "" && last.ID == run.ID {
+		// Saved already by a try of the run that failed after saving it.
+		state.Runs = state.Runs[:len(state.Runs)-1]
+	}
+	state.Runs = append(state.Runs, run)
+	if len(state.Runs) > maxRunsInState {
+		state.Runs = state.Runs[len(state.Runs)-maxRunsInState:]
+	}
+	return b.saveState(state)
+}
+
+// removeRun takes the run with the ID out of the state file, so that the next run resumes from the one before it.
+func (b *Bot) removeRun(id string) error {
+	state, err := b.loadState()
+	if err != nil {
+		return err
+	}
+	var runs []*runRecord
+	for _, run := range state.Runs {
+		if run.ID != id {
+			runs = append(runs, run)
+		}
+	}
+	state.Runs = runs
+	return b.saveState(state)
+}
+
+func (b *Bot) saveState(state *botState) error {
+	err := ensureDirExists(b.dataDir + stateDir)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(b.statePath(), state)
+}
+
+func writeJSONFile(fileName string, value interface{}) error {
+	contents, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fileName, contents)
+}
@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	transcriptDirectory = "transcripts"
+	// The destination of messages that are only sent to the reviewers.
+	reviewersDestination = "reviewers"
+)
+
+// TranscriptEntry is one message that a print_everything run would have sent in full_send.
+type TranscriptEntry struct {
+	// The number of the message in the run, starting at 1.
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// The channel that the message would go to in full_send, stdout for messages that full_send only
+	// prints, or reviewers for messages that only dm_for_review sends.
+	Destination string `json:"destination"`
+	// The ID of the message that this one replies to.
+	ThreadParent string        `json:"thread_parent,omitempty"`
+	Text         string        `json:"text"`
+	Blocks       *slack.Blocks `json:"blocks,omitempty"`
+}
+
+// transcript collects what a run would post. In print_everything mode, reviewers can diff it against the
+// run of the week before, and tests compare it against golden files. With interactive_review, it is the
+// preview that is posted when a reviewer approves it.
+type transcript struct {
+	entries []*TranscriptEntry
+	// The IDs of the entries by the ID that their message was sent with, to find the parents of replies.
+	entryIds map[string]string
+}
+
+func newTranscript() *transcript {
+	return &transcript{entryIds: map[string]string{}}
+}
+
+// add numbers the entry and returns the ID to reply to it with, which is sentId, or the ID of the entry
+// when the message was not sent.
+func (t *transcript) add(entry *TranscriptEntry, threadId, sentId string) string {
+	entry.ID = strconv.Itoa(len(t.entries) + 1)
+	entry.ThreadParent = t.entryIds[threadId]
+	if sentId == "" {
+		sentId = entry.ID
+	}
+	t.entryIds[sentId] = entry.ID
+	t.entries = append(t.entries, entry)
+	return sentId
+}
+
+// marshalJSONLines writes one entry per line.
+func (t *transcript) marshalJSONLines() ([]byte, error) {
+	var out bytes.Buffer
+	for _, entry := range t.entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// fullSendDestination is where full_send sends messages of the type.
+func (b *Bot) fullSendDestination(level MessageType) string {
+	switch level {
+	case MSG_TYPE__SEND, MSG_TYPE__SEND_AND_REVIEW:
+		return b.config.EmojiChannel
+	case MSG_TYPE__REVIEW_ONLY:
+		// full_send does not send these anywhere, but dm_for_review does.
+		return reviewersDestination
+	default:
+		return stdoutSinkName
+	}
+}
+
+// addToTranscript adds a message to the transcript of the run, if it has one.
+func (b *Bot) addToTranscript(level MessageType, message *renderedMessage, threadId, sentId string) string {
+	if b.transcript == nil {
+		return sentId
+	}
+	// What an approved preview posts, so the mentions ping like they do in full_send.
+	message = postableMentions(message)
+	entry := &TranscriptEntry{
+		Type:        level.String(),
+		Destination: b.fullSendDestination(level),
+		Text:        message.text,
+	}
+	if !b.config.PlainTextMessages && len(message.blocks) > 0 {
+		entry.Blocks = &slack.Blocks{BlockSet: message.blocks}
+	}
+	return b.transcript.add(entry, threadId, sentId)
+}
+
+// dryRun prints a message in print_everything mode and adds it to the transcript with where full_send
+// would have sent it. It returns the ID of the entry, so that replies can point to it.
+func (b *Bot) dryRun(level MessageType, message *renderedMessage, threadId string) (string, error) {
+	b.print(message)
+	if b.transcript == nil {
+		return "", nil
+	}
+	return b.addToTranscript(level, message, threadId, ""), nil
+}
+
+// transcriptPath is where the transcript of a report is written, with the day of the run in the name so
+// that the transcripts of different weeks can be diffed.
+func (b *Bot) transcriptPath(reportName string) string {
+	return filepath.Join(b.dataDir+transcriptDirectory, reportName+"-"+b.clock.Now().Format("2006-01-02")+".jsonl")
+}
+
+// writeTranscript saves the transcript of the report, if the run made one.
+func (b *Bot) writeTranscript(reportName string) error {
+	if b.transcript == nil {
+		return nil
+	}
+	contents, err := b.transcript.marshalJSONLines()
+	if err != nil {
+		return err
+	}
+	path := b.transcriptPath(reportName)
+	err = ensureDirExists(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(path, contents)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(b.out, "Wrote the transcript of the run to %v\n", path)
+	return nil
+}
@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryho/slack-emoji-bot/fakeslack"
+)
+
+var updateGolden = flag.Bool("update", false, "Write the transcripts of the golden tests to testdata/golden.")
+
+// TestReportsMatchGoldenTranscripts runs every report in print_everything mode, and compares what it would
+// post with testdata/golden. Run "go test ./bot -run Golden -update" after changing a message on purpose.
+func TestReportsMatchGoldenTranscripts(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		run  func(b *Bot, server *fakeslack.Server) error
+	}{
+		{"weekly", func(b *Bot, server *fakeslack.Server) error { return b.RunWeekly() }},
+		{"top_uploaders", func(b *Bot, server *fakeslack.Server) error { return b.RunTopUploaders(true) }},
+		{"longest", func(b *Bot, server *fakeslack.Server) error { return b.RunLongest() }},
+		{"deleted", func(b *Bot, server *fakeslack.Server) error {
+			// The report has the upload time of the deleted emoji in time_zone.
+			b.config.TimeZone = "UTC"
+			server.AddEmoji(fakeslack.Emoji{Name: "deleted-one", Url: "https://emoji.example.com/deleted-one.png",
+				Created: 1735689600, UserId: "U3", UserDisplayName: "User U3"})
+			// Save the snapshot that the run compares with.
+			_, err := b.getAllEmojis()
+			if err != nil {
+				return err
+			}
+			server.RemoveEmoji("deleted-one")
+			return b.RunDeleted()
+		}},
+		{"wrapped", func(b *Bot, server *fakeslack.Server) error { return b.RunWrapped(2025) }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b, server := setupWeekly(t)
+			addEmoji(server, "new-one", "U1", 2*24*time.Hour)
+			addEmoji(server, "new-two", "U2", 24*time.Hour)
+			addEmoji(server, "new-three", "U2", time.Hour)
+			b.config.RunMode = MODE__PRINT_EVERYTHING
+
+			err := test.run(b, server)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(server.Posted()) > 0 {
+				t.Errorf("a dry run posted %v messages", len(server.Posted()))
+			}
+			got, err := os.ReadFile(b.transcriptPath(test.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			goldenPath := filepath.Join("testdata", "golden", test.name+".jsonl")
+			if *updateGolden {
+				err = os.MkdirAll(filepath.Dir(goldenPath), 0777)
+				if err == nil {
+					err = os.WriteFile(goldenPath, got, 0644)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("the transcript does not match %v, run with -update if the change is on purpose.\ngot:\n%v\nwant:\n%v",
+					goldenPath, strings.TrimSpace(string(got)), strings.TrimSpace(string(want)))
+			}
+		})
+	}
+}
+
+func TestDryRunThreadsRepliesToTheirParent(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", time.Hour)
+	b.config.RunMode = MODE__PRINT_EVERYTHING
+
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(b.transcriptPath("weekly"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var promptId string
+	var replies int
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		entry := &TranscriptEntry{}
+		err = json.Unmarshal([]byte(line), entry)
+		if err != nil {
+			t.Fatalf("%v in %q", err, line)
+		}
+		if entry.Text == votePrompt {
+			promptId = entry.ID
+			if entry.Destination != b.config.EmojiChannel {
+				t.Errorf("the vote prompt would go to %q", entry.Destination)
+			}
+		} else if entry.ThreadParent == promptId && promptId != "" {
+			replies++
+		}
+	}
+	if promptId == "" || replies != 2 {
+		t.Errorf("got vote prompt %q with %v replies, want 2 replies", promptId, replies)
+	}
+}
@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ryho/slack-emoji-bot/util"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+const (
+	stateDir        = "state/"
+	preferencesFile = "preferences.json"
+
+	userCommandHelpMessage  = "Send me one of these:\n• *mute me* to show your name without pinging you\n• *unmute me*\n• *skip me* to leave you out of the bot all together\n• *unskip me*"
+	userCommandErrorMessage = "Sorry, something went wrong. Please message @%s."
+	mutedMessage            = "Done, I will show your name without the @ sign so you will not be pinged."
+	unmutedMessage          = "Done, I will @ you again."
+	skippedMessage          = "Done, I will leave you out of the bot all together."
+	unskippedMessage        = "Done, you will show up in the bot again."
+)
+
+// userPreferences are the mute and skip lists that people manage themselves by messaging the bot.
+// They are used together with mute_ldaps and skip_ldaps from the config file.
+type userPreferences struct {
+	// User IDs of people who do not want to be pinged.
+	Muted util.StringSet `json:"muted"`
+	// User IDs of people who do not want to show up at all.
+	Skipped util.StringSet `json:"skipped"`
+	// Emojis that reviewers left out with the Edit skip list button, on top of skip_emojis.
+	SkippedEmojis util.StringSet `json:"skipped_emojis"`
+
+	// mute_ldaps and skip_ldaps from the config file.
+	muteLDAPs, skipLDAPs util.StringSet
+}
+
+func (b *Bot) preferencesPath() string {
+	return b.dataDir + stateDir + preferencesFile
+}
+
+func (b *Bot) loadPreferences() (*userPreferences, error) {
+	b.preferencesLock.Lock()
+	defer b.preferencesLock.Unlock()
+	prefs, err := b.readPreferences()
+	if err != nil {
+		return nil, err
+	}
+	prefs.muteLDAPs = b.config.MuteLDAPs
+	prefs.skipLDAPs = b.config.SkipLDAPs
+	return prefs, nil
+}
+
+func (b *Bot) readPreferences() (*userPreferences, error) {
+	prefs := &userPreferences{Muted: util.StringSet{}, Skipped: util.StringSet{}, SkippedEmojis: util.StringSet{}}
+	contents, err := ioutil.ReadFile(b.preferencesPath())
+	if os.IsNotExist(err) {
+		return prefs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(contents, prefs)
+	if err != nil {
+		return nil, err
+	}
+	if prefs.Muted == nil {
+		prefs.Muted = util.StringSet{}
+	}
+	if prefs.Skipped == nil {
+		prefs.Skipped = util.StringSet{}
+	}
+	if prefs.SkippedEmojis == nil {
+		prefs.SkippedEmojis = util.StringSet{}
+	}
+	return prefs, nil
+}
+
+// updatePreferences loads the preferences, applies the change and saves them.
+func (b *Bot) updatePreferences(change func(prefs *userPreferences)) error {
+	b.preferencesLock.Lock()
+	defer b.preferencesLock.Unlock()
+	prefs, err := b.readPreferences()
+	if err != nil {
+		return err
+	}
+	change(prefs)
+	err = ensureDirExists(b.dataDir + stateDir)
+	if err != nil {
+		return err
+	}
+	prefsBytes, err := json.MarshalIndent(prefs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(b.preferencesPath(), prefsBytes, 0644)
+}
+
+func (p *userPreferences) isMuted(user *slack.User) bool {
+	if _, ok := p.muteLDAPs[user.Profile.DisplayName]; ok {
+		return true
+	}
+	_, ok := p.Muted[user.ID]
+	return ok
+}
+
+func (p *userPreferences) isSkipped(user *slack.User) bool {
+	if _, ok := p.skipLDAPs[user.Profile.DisplayName]; ok {
+		return true
+	}
+	_, ok := p.Skipped[user.ID]
+	return ok
+}
+
+func (b *Bot) handleDirectMessage(event *slackevents.MessageEvent) error {
+	// Ignore messages from bots, including this one, and edits.
+	if event.ChannelType != "im" || event.BotID != "" || event.SubType != "" {
+		return nil
+	}
+	reply, err := b.handleUserCommand(event.User, event.Text)
+	if err != nil {
+		fmt.Fprintf(b.out, "Unable to handle command %q from %v: %v\n", event.Text, event.User, err)
+		reply = fmt.Sprintf(userCommandErrorMessage, b.config.OwnerLDAP)
+	}
+	_, err = b.postOutsideRun(event.Channel, plainMessage(reply), "")
+	return err
+}
+
+// handleUserCommand handles "mute me", "unmute me", "skip me" and "unskip me"
+// from a DM or the slash command, and returns the reply.
+func (b *Bot) handleUserCommand(userId, text string) (string, error) {
+	command := strings.ToLower(strings.Trim(strings.TrimSpace(text), ".!"))
+	command = strings.TrimSuffix(command, " me")
+	var reply string
+	var change func(prefs *userPreferences)
+	switch command {
+	case "mute":
+		reply = mutedMessage
+		change = func(prefs *userPreferences) { prefs.Muted[userId] = util.SetEntry{} }
+	case "unmute":
+		reply = unmutedMessage
+		change = func(prefs *userPreferences) { delete(prefs.Muted, userId) }
+	case "skip":
+		reply = skippedMessage
+		change = func(prefs *userPreferences) { prefs.Skipped[userId] = util.SetEntry{} }
+	case "unskip":
+		reply = unskippedMessage
+		change = func(prefs *userPreferences) { delete(prefs.Skipped, userId) }
+	default:
+		return userCommandHelpMessage, nil
+	}
+	err := b.updatePreferences(change)
+	if err != nil {
+		return "", err
+	}
+	return reply, nil
+}
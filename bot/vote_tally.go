@@ -0,0 +1,170 @@
+package bot
+
+import (
+	"sort"
+)
+
+const (
+	VOTE_TALLY__APPROVAL      = "approval"
+	VOTE_TALLY__PLURALITY     = "plurality"
+	VOTE_TALLY__RANKED_CHOICE = "ranked_choice"
+)
+
+// VoteTally decides how the votes on the vote prompts are counted.
+type VoteTally interface {
+	// Tally scores every emoji on the ballots and ranks them, best first. Emojis that are tied have the same
+	// rank, and are sorted by name, unless the tally breaks ties.
+	Tally(ballots []*Ballot) []*TalliedEmoji
+}
+
+// Ballot is the votes of one person on one vote prompt, with the emoji they picked first at the front.
+type Ballot struct {
+	// Empty for the votes that Slack does not say the voter of.
+	Voter  string
+	Emojis []string
+}
+
+// TalliedEmoji is the result of an emoji in a tally.
+type TalliedEmoji struct {
+	Name string
+	// The votes that counted for the emoji, which is what min_votes is compared to.
+	Votes int
+	// What the emoji is ranked by. It is the same as Votes, unless votes are split between emojis.
+	Score float64
+	// 1 for the winners.
+	Rank int
+}
+
+// voteTally returns the tally from WithVoteTally, or the one that vote_tally picks.
+func (b *Bot) voteTally() VoteTally {
+	if b.tally != nil {
+		return b.tally
+	}
+	switch b.config.VoteTally {
+	case VOTE_TALLY__PLURALITY:
+		return pluralityTally{}
+	case VOTE_TALLY__RANKED_CHOICE:
+		return rankedChoiceTally{}
+	}
+	return approvalTally{equalWeight: b.config.EqualVoterWeight}
+}
+
+// approvalTally gives a vote to every emoji that someone voted for. This is how the votes were always counted.
+type approvalTally struct {
+	// Split the vote of each person between the emojis they voted for.
+	equalWeight bool
+}
+
+func (t approvalTally) Tally(ballots []*Ballot) []*TalliedEmoji {
+	emojis := map[string]*TalliedEmoji{}
+	for _, ballot := range ballots {
+		weight := 1.0
+		if t.equalWeight {
+			weight /= float64(len(ballot.Emojis))
+		}
+		for _, name := range ballot.Emojis {
+			emoji := talliedEmoji(emojis, name)
+			emoji.Votes++
+			emoji.Score += weight
+		}
+	}
+	return rankByScore(emojis)
+}
+
+// pluralityTally only counts the first emoji that each person voted for.
+type pluralityTally struct{}
+
+func (pluralityTally) Tally(ballots []*Ballot) []*TalliedEmoji {
+	emojis := map[string]*TalliedEmoji{}
+	for _, ballot := range ballots {
+		for i, name := range ballot.Emojis {
+			emoji := talliedEmoji(emojis, name)
+			if i == 0 {
+				emoji.Votes++
+				emoji.Score++
+			}
+		}
+	}
+	return rankByScore(emojis)
+}
+
+// rankedChoiceTally is an instant runoff. Each round, every ballot counts for its first emoji that is still
+// in the running, and the emoji with the fewest votes is out. When emojis are tied for the fewest votes, the one
+// that was the first pick of fewer people is out, and after that the one whose name sorts last. Only one emoji
+// is out each round, since the votes it passes on can save an emoji it was tied with. The emojis that lasted
+// longer rank higher, so no two emojis share a rank, and the score of each emoji is its votes in its last round.
+type rankedChoiceTally struct{}
+
+func (rankedChoiceTally) Tally(ballots []*Ballot) []*TalliedEmoji {
+	running := map[string]bool{}
+	firstPicks := map[string]int{}
+	for _, ballot := range ballots {
+		for i, name := range ballot.Emojis {
+			running[name] = true
+			if i == 0 {
+				firstPicks[name]++
+			}
+		}
+	}
+	// The emojis in the order they were out, so the winner is last.
+	var out []*TalliedEmoji
+	for len(running) > 0 {
+		votes := map[string]int{}
+		for name := range running {
+			votes[name] = 0
+		}
+		for _, ballot := range ballots {
+			for _, name := range ballot.Emojis {
+				if running[name] {
+					votes[name]++
+					break
+				}
+			}
+		}
+		loser := ""
+		for name, count := range votes {
+			if loser == "" || count < votes[loser] ||
+				(count == votes[loser] && (firstPicks[name] < firstPicks[loser] ||
+					(firstPicks[name] == firstPicks[loser] && name > loser))) {
+				loser = name
+			}
+		}
+		out = append(out, &TalliedEmoji{Name: loser, Votes: votes[loser], Score: float64(votes[loser])})
+		delete(running, loser)
+	}
+	var ranked []*TalliedEmoji
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i].Rank = len(ranked) + 1
+		ranked = append(ranked, out[i])
+	}
+	return ranked
+}
+
+func talliedEmoji(emojis map[string]*TalliedEmoji, name string) *TalliedEmoji {
+	if _, ok := emojis[name]; !ok {
+		emojis[name] = &TalliedEmoji{Name: name}
+	}
+	return emojis[name]
+}
+
+// rankByScore sorts the emojis by score, and then name, and gives emojis with the same score the same rank.
+func rankByScore(emojis map[string]*TalliedEmoji) []*TalliedEmoji {
+	var ranked []*TalliedEmoji
+	for _, emoji := range emojis {
+		ranked = append(ranked, emoji)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score == ranked[j].Score {
+			return ranked[i].Name < ranked[j].Name
+		}
+		return ranked[i].Score > ranked[j].Score
+	})
+	for i, emoji := range ranked {
+		if i > 0 && emoji.Score == ranked[i-1].Score {
+			emoji.Rank = ranked[i-1].Rank
+		} else {
+			emoji.Rank = i + 1
+		}
+	}
+	return ranked
+}
@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func ballots(votes ...string) []*Ballot {
+	var result []*Ballot
+	for i, vote := range votes {
+		result = append(result, &Ballot{Voter: fmt.Sprintf("U%d", i+1), Emojis: strings.Fields(vote)})
+	}
+	return result
+}
+
+// formatTally is each emoji as rank. name score.
+func formatTally(emojis []*TalliedEmoji) string {
+	var parts []string
+	for _, emoji := range emojis {
+		parts = append(parts, fmt.Sprintf("%d. %s %v", emoji.Rank, emoji.Name, emoji.Score))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func TestVoteTallies(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		tally   VoteTally
+		ballots []*Ballot
+		want    string
+	}{{
+		name:    "approval counts every vote",
+		tally:   approvalTally{},
+		ballots: ballots("a b", "b c", "b"),
+		want:    "1. b 3, 2. a 1, 2. c 1",
+	}, {
+		name:    "approval ties share a rank",
+		tally:   approvalTally{},
+		ballots: ballots("b a", "a b", "c"),
+		want:    "1. a 2, 1. b 2, 3. c 1",
+	}, {
+		name:    "approval with equal weight",
+		tally:   approvalTally{equalWeight: true},
+		ballots: ballots("a b", "a", "c d"),
+		want:    "1. a 1.5, 2. b 0.5, 2. c 0.5, 2. d 0.5",
+	}, {
+		name:    "plurality only counts the first pick",
+		tally:   pluralityTally{},
+		ballots: ballots("a b", "a", "b c"),
+		want:    "1. a 2, 2. b 1, 3. c 0",
+	}, {
+		name:    "plurality ties share a rank",
+		tally:   pluralityTally{},
+		ballots: ballots("a b", "b a", "c a"),
+		want:    "1. a 1, 1. b 1, 1. c 1",
+	}, {
+		name:  "ranked choice moves the votes of the emoji that is out",
+		tally: rankedChoiceTally{},
+		// c is out first, and its vote goes to b, which then beats a.
+		ballots: ballots("a c", "a", "b c", "b", "c b"),
+		want:    "1. b 3, 2. a 2, 3. c 1",
+	}, {
+		name:  "ranked choice puts out one emoji each round",
+		tally: rankedChoiceTally{},
+		// c and d are tied for last. d is out by name, and its votes save c, which then gets the votes of
+		// b. Putting out c and d together would give their votes to a, and a would win.
+		ballots: ballots("a", "a", "a", "a", "b c", "b c", "b c", "c a", "c a", "d c", "d c"),
+		want:    "1. c 7, 2. a 4, 3. b 3, 4. d 2",
+	}, {
+		name:  "ranked choice breaks ties for last by first picks",
+		tally: rankedChoiceTally{},
+		// After d is out, b and c both have 2 votes, but c was the first pick of more people.
+		ballots: ballots("a", "a", "a", "c", "c", "b", "d b"),
+		want:    "1. a 3, 2. c 2, 3. b 2, 4. d 1",
+	}, {
+		name:    "ranked choice breaks ties for last by name",
+		tally:   rankedChoiceTally{},
+		ballots: ballots("a", "a", "b a", "c"),
+		want:    "1. a 3, 2. b 1, 3. c 1",
+	}, {
+		name:    "ranked choice breaks a tie for the win",
+		tally:   rankedChoiceTally{},
+		ballots: ballots("a c", "b c", "a", "b", "c"),
+		// c is out first, and its vote goes nowhere. Then a and b are tied, and b is out by name.
+		want: "1. a 2, 2. b 2, 3. c 1",
+	}, {
+		name:    "ranked choice without votes",
+		tally:   rankedChoiceTally{},
+		ballots: nil,
+		want:    "",
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			got := formatTally(test.tally.Tally(test.ballots))
+			if got != test.want {
+				t.Errorf("got %q, expected %q", got, test.want)
+			}
+		})
+	}
+}
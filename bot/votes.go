@@ -0,0 +1,442 @@
+package bot
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ryho/slack-emoji-bot/util"
+	"github.com/slack-go/slack"
+)
+
+// exclusionReason is why a vote was not counted.
+type exclusionReason string
+
+const (
+	EXCLUDED__BOT       exclusionReason = "Reactions from the bot"
+	EXCLUDED__NOT_NEW   exclusionReason = "Not one of the new emojis that were up for the vote"
+	EXCLUDED__OWN_EMOJI exclusionReason = "Votes for their own emoji"
+	EXCLUDED__OVER_MAX  exclusionReason = "Over the limit of votes per person"
+)
+
+// The order that the exclusions are listed in the review DM.
+var exclusionReasons = []exclusionReason{EXCLUDED__BOT, EXCLUDED__NOT_NEW, EXCLUDED__OWN_EMOJI, EXCLUDED__OVER_MAX}
+
+const unorderedVotesMessage = "*The order of some votes is not known:* serve did not see when %d people added some of " +
+	"their reactions, so their votes are in the order of the reactions on the vote prompt, and not in the order they voted. " +
+	"This is used for their first pick, for their ranking with ranked_choice, and for max_votes_per_voter."
+
+// emojiResolver finds the emojis that were voted for.
+type emojiResolver struct {
+	b      *Bot
+	emojis *SlackEmojiResponseMessage
+	// The emojis that were looked up in the history, including the ones that were not found.
+	fromHistory map[string]*Emoji
+}
+
+func (b *Bot) emojiResolver(emojis *SlackEmojiResponseMessage) *emojiResolver {
+	return &emojiResolver{b: b, emojis: emojis, fromHistory: map[string]*Emoji{}}
+}
+
+// lookup finds an emoji in the emojis that were downloaded, or in the history if it is not there, which happens
+// in fast mode for emojis from before last week, and for emojis that were deleted since. Returns nil for
+// standard emojis, and custom emojis that the bot never saw.
+func (r *emojiResolver) lookup(name string) (*Emoji, error) {
+	if emoji, ok := r.emojis.emojiMap[name]; ok {
+		return emoji, nil
+	}
+	if emoji, ok := r.fromHistory[name]; ok {
+		return emoji, nil
+	}
+	record, err := r.b.emojiHistory(name)
+	if err != nil {
+		return nil, err
+	}
+	var emoji *Emoji
+	if record != nil {
+		emoji = record.emoji()
+	}
+	r.fromHistory[name] = emoji
+	return emoji, nil
+}
+
+// resolve finds the emoji that was uploaded for a reaction. If the reaction is an alias, that is the emoji
+// that the alias is for, and alias is the alias itself. An alias for a standard emoji is its own emoji,
+// since nobody uploaded the emoji it is for.
+func (r *emojiResolver) resolve(name string) (emoji *Emoji, alias *Emoji, err error) {
+	emoji, err = r.lookup(name)
+	if err != nil || emoji == nil || emoji.AliasFor == "" {
+		return emoji, nil, err
+	}
+	original, err := r.lookup(emoji.AliasFor)
+	if err != nil || original == nil {
+		return emoji, nil, err
+	}
+	return original, emoji, nil
+}
+
+// newEmojiWindow is when the emojis that were up for a vote were uploaded, as unix times.
+type newEmojiWindow struct {
+	from, to int64
+}
+
+// contains is whether the emoji was uploaded after from, and at or before to.
+func (w *newEmojiWindow) contains(emoji *Emoji) bool {
+	return emoji != nil && int64(emoji.Created) > w.from && int64(emoji.Created) <= w.to
+}
+
+// newEmojiWindows returns the window of the new emojis of each vote prompt, by the timestamp of the prompt.
+// The weekly vote is on the emojis between the start and the last emoji of the previous run. The prompts of
+// Emojis Wrapped are on the emojis uploaded since the prompt before them. Prompts without a known window are
+// left out.
+func (b *Bot) newEmojiWindows(resolver *emojiResolver, wrappedYear int, messages []*slack.Message) (map[string]*newEmojiWindow, error) {
+	windows := map[string]*newEmojiWindow{}
+	if wrappedYear == 0 {
+		window := &newEmojiWindow{from: b.previousLastNewEmojiCreated, to: b.lastNewEmojiCreated}
+		// Runs that resumed from the channel only know the names of the emojis.
+		for _, bound := range []struct {
+			created *int64
+			name    string
+		}{{&window.from, b.previousLastNewEmoji}, {&window.to, b.lastNewEmoji}} {
+			if *bound.created != 0 || bound.name == "" {
+				continue
+			}
+			emoji, err := resolver.lookup(bound.name)
+			if err != nil {
+				return nil, err
+			}
+			if emoji != nil {
+				*bound.created = int64(emoji.Created)
+			}
+		}
+		if window.to == 0 {
+			return windows, nil
+		}
+		for _, message := range messages {
+			windows[message.Timestamp] = window
+		}
+		return windows, nil
+	}
+	times := map[string]time.Time{}
+	for _, message := range messages {
+		timestamp, err := timeFromMessage(message)
+		if err != nil {
+			return nil, err
+		}
+		times[message.Timestamp] = timestamp
+	}
+	sorted := append([]*slack.Message{}, messages...)
+	sort.Slice(sorted, func(i, j int) bool { return times[sorted[i].Timestamp].Before(times[sorted[j].Timestamp]) })
+	for i, message := range sorted {
+		window := &newEmojiWindow{to: times[message.Timestamp].Unix()}
+		if i == 0 {
+			window.from = times[message.Timestamp].AddDate(0, 0, -firstRunDays).Unix()
+		} else {
+			window.from = times[sorted[i-1].Timestamp].Unix()
+		}
+		windows[message.Timestamp] = window
+	}
+	return windows, nil
+}
+
+// votedEmoji is an emoji on a vote prompt, after following aliases.
+type votedEmoji struct {
+	name string
+	// Who uploaded the emoji, or empty for emojis that the bot does not know.
+	uploader string
+	// The aliases that were voted with, and who created each of them.
+	aliases map[string]string
+}
+
+// ballot is how one person voted on one vote prompt, while the votes are counted.
+type ballot struct {
+	voter string
+	votes []*votedEmoji
+	// When the person added each vote, if serve saw it.
+	added map[*votedEmoji]time.Time
+}
+
+// excludedVote is a vote that the vote rules left out.
+type excludedVote struct {
+	// Empty for the votes that Slack does not say the voter of.
+	voter  string
+	emoji  string
+	votes  int
+	reason exclusionReason
+}
+
+// emojiVoteCount is the result of an emoji, including the votes for its aliases.
+type emojiVoteCount struct {
+	*votedEmoji
+	*TalliedEmoji
+}
+
+// countedVotes is the result of the vote prompts.
+type countedVotes struct {
+	// Sorted by rank, and then name.
+	emojis []*emojiVoteCount
+	// How many people have votes that were counted.
+	voters   int
+	excluded []*excludedVote
+	// How many people voted for more than one emoji, without serve seeing when they added each reaction.
+	unorderedVoters int
+}
+
+// countVotes counts the reactions on the vote prompts by the emoji that was uploaded, so votes for an alias
+// count for the emoji it is for, and someone who voted with both an emoji and its alias has one vote. The
+// vote rules in the config decide which votes count, and the vote tally decides the winners.
+func (b *Bot) countVotes(resolver *emojiResolver, wrappedYear int, messages []*slack.Message) (*countedVotes, error) {
+	var windows map[string]*newEmojiWindow
+	if b.config.OnlyVotesForNewEmojis {
+		var err error
+		windows, err = b.newEmojiWindows(resolver, wrappedYear, messages)
+		if err != nil {
+			return nil, err
+		}
+	}
+	counted := &countedVotes{}
+	emojis := map[string]*votedEmoji{}
+	var ballots []*Ballot
+	voters := util.StringSet{}
+	for _, message := range messages {
+		window, ok := windows[message.Timestamp]
+		if b.config.OnlyVotesForNewEmojis && !ok {
+			fmt.Fprintf(b.out, "The new emojis of the vote prompt %v are not known, so all of its votes count.\n", message.Timestamp)
+		}
+		timeline, err := b.reactionTimeline(message.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		userBallots := map[string]*ballot{}
+		var order []*ballot
+		for _, reaction := range message.Reactions {
+			emoji, alias, err := resolver.resolve(reaction.Name)
+			if err != nil {
+				return nil, err
+			}
+			voted := &votedEmoji{name: reaction.Name, aliases: map[string]string{}}
+			if emoji != nil {
+				voted.name = emoji.Name
+				voted.uploader = emoji.UserId
+			}
+			if existing, ok := emojis[voted.name]; ok {
+				voted = existing
+			} else {
+				emojis[voted.name] = voted
+			}
+			// A new alias for an older emoji is one of the new emojis too.
+			isNew := window == nil || window.contains(emoji) || window.contains(alias)
+			countedAny := false
+			for _, user := range reaction.Users {
+				reason := b.excludeVote(message, user, voted, isNew)
+				if reason != "" {
+					counted.excluded = append(counted.excluded, &excludedVote{voter: user, emoji: reaction.Name, votes: 1, reason: reason})
+					continue
+				}
+				userBallot, ok := userBallots[user]
+				if !ok {
+					userBallot = &ballot{voter: user, added: map[*votedEmoji]time.Time{}}
+					userBallots[user] = userBallot
+					order = append(order, userBallot)
+				}
+				if !containsEmoji(userBallot.votes, voted) {
+					userBallot.votes = append(userBallot.votes, voted)
+				}
+				// Voting with an emoji and its alias counts from the first of the two.
+				if added, ok := timeline[user][reaction.Name]; ok {
+					if earlier, ok := userBallot.added[voted]; !ok || added.Before(earlier) {
+						userBallot.added[voted] = added
+					}
+				}
+				countedAny = true
+			}
+			// Slack only lists some of the users for reactions with a lot of them, so only the new
+			// emoji rule applies to the rest, and each of their votes is a ballot of its own.
+			if unlisted := reaction.Count - len(reaction.Users); unlisted > 0 {
+				if !isNew {
+					counted.excluded = append(counted.excluded, &excludedVote{emoji: reaction.Name, votes: unlisted, reason: EXCLUDED__NOT_NEW})
+				} else {
+					for i := 0; i < unlisted; i++ {
+						ballots = append(ballots, &Ballot{Emojis: []string{voted.name}})
+					}
+					countedAny = true
+				}
+			}
+			if alias != nil && countedAny {
+				voted.aliases[alias.Name] = alias.UserId
+			}
+		}
+		for _, userBallot := range order {
+			if len(userBallot.votes) > 1 && len(userBallot.added) < len(userBallot.votes) {
+				counted.unorderedVoters++
+			}
+			// The reactions on the prompt are in the order that each emoji was first reacted with. The
+			// reactions that serve saw go first, in the order they were added.
+			sort.SliceStable(userBallot.votes, func(i, j int) bool {
+				addedI, okI := userBallot.added[userBallot.votes[i]]
+				addedJ, okJ := userBallot.added[userBallot.votes[j]]
+				if okI && okJ {
+					return addedI.Before(addedJ)
+				}
+				return okI && !okJ
+			})
+			if max := b.config.MaxVotesPerVoter; max > 0 && len(userBallot.votes) > max {
+				for _, emoji := range userBallot.votes[max:] {
+					counted.excluded = append(counted.excluded, &excludedVote{voter: userBallot.voter, emoji: emoji.name, votes: 1, reason: EXCLUDED__OVER_MAX})
+				}
+				userBallot.votes = userBallot.votes[:max]
+			}
+			result := &Ballot{Voter: userBallot.voter}
+			for _, emoji := range userBallot.votes {
+				result.Emojis = append(result.Emojis, emoji.name)
+			}
+			ballots = append(ballots, result)
+			voters[userBallot.voter] = util.SetEntry{}
+		}
+	}
+	for _, tallied := range b.voteTally().Tally(ballots) {
+		emoji, ok := emojis[tallied.Name]
+		if !ok {
+			// A tally from WithVoteTally can only rank the emojis on the ballots.
+			continue
+		}
+		counted.emojis = append(counted.emojis, &emojiVoteCount{votedEmoji: emoji, TalliedEmoji: tallied})
+	}
+	counted.voters = len(voters)
+	return counted, nil
+}
+
+// excludeVote returns why a vote does not count, or an empty reason if it does.
+func (b *Bot) excludeVote(message *slack.Message, user string, emoji *votedEmoji, isNew bool) exclusionReason {
+	switch {
+	case b.config.IgnoreBotVotes && message.BotID != "" && user == message.User:
+		return EXCLUDED__BOT
+	case !isNew:
+		return EXCLUDED__NOT_NEW
+	case b.config.IgnoreSelfVotes && user == emoji.uploader:
+		return EXCLUDED__OWN_EMOJI
+	}
+	return ""
+}
+
+func containsEmoji(emojis []*votedEmoji, emoji *votedEmoji) bool {
+	for _, other := range emojis {
+		if other == emoji {
+			return true
+		}
+	}
+	return false
+}
+
+// topVotedEmojis picks the top emojis to print, and the rank to print each of them with. Emojis that are
+// tied have the same rank, and are all printed even if that goes over maxPrintCount. Emojis with fewer than
+// min_votes votes, and with needUploader, emojis without a known uploader, are left out.
+func (b *Bot) topVotedEmojis(emojis []*emojiVoteCount, maxPrintCount int, needUploader bool) ([]*emojiVoteCount, []int) {
+	var printed []*emojiVoteCount
+	var ranks []int
+	for _, emoji := range emojis {
+		tied := len(printed) > 0 && emoji.Rank == printed[len(printed)-1].Rank
+		if !tied && len(printed) >= maxPrintCount {
+			break
+		}
+		if emoji.Votes < b.config.MinVotes {
+			continue
+		}
+		if needUploader && emoji.uploader == "" {
+			fmt.Fprintf(b.out, "Leaving :%v: out of the top emojis, since it is not a custom emoji that the bot knows who uploaded.\n", emoji.name)
+			continue
+		}
+		if tied {
+			ranks = append(ranks, ranks[len(ranks)-1])
+		} else {
+			ranks = append(ranks, len(printed)+1)
+		}
+		printed = append(printed, emoji)
+	}
+	return printed, ranks
+}
+
+// formatVotes is the score of an emoji as it is printed in the top emojis.
+func (b *Bot) formatVotes(emoji *emojiVoteCount) string {
+	if emoji.Score != math.Trunc(emoji.Score) {
+		return b.printer.Sprintf("%.1f", emoji.Score)
+	}
+	return b.printer.Sprintf("%d", int(emoji.Score))
+}
+
+// printExcludedVotes tells the reviewers which votes the vote rules left out, and why.
+func (b *Bot) printExcludedVotes(excluded []*excludedVote) error {
+	if len(excluded) == 0 {
+		return nil
+	}
+	var voterIds []string
+	for _, vote := range excluded {
+		if vote.voter != "" {
+			voterIds = append(voterIds, vote.voter)
+		}
+	}
+	users, err := b.getUsers(voterIds)
+	if err != nil {
+		return err
+	}
+	names := map[string]string{}
+	for id, user := range users {
+		names[id] = user.RealName
+	}
+	_, err = b.printMessages(MSG_TYPE__REVIEW_ONLY, renderExcludedVotes(excluded, names), "")
+	return err
+}
+
+// printUnorderedVotes tells the reviewers when the order of the votes mattered, but serve did not see it.
+func (b *Bot) printUnorderedVotes(counted *countedVotes) error {
+	if _, isApproval := b.voteTally().(approvalTally); counted.unorderedVoters == 0 || (isApproval && b.config.MaxVotesPerVoter == 0) {
+		return nil
+	}
+	_, err := b.printMessage(MSG_TYPE__REVIEW_ONLY, fmt.Sprintf(unorderedVotesMessage, counted.unorderedVoters))
+	return err
+}
+
+// aliasNotes says which aliases each emoji was voted with, and who made them, for note_alias_creators.
+func (b *Bot) aliasNotes(counts []*emojiVoteCount) ([]string, error) {
+	var creatorIds []string
+	for _, count := range counts {
+		for _, creator := range count.aliases {
+			if creator != "" {
+				creatorIds = append(creatorIds, creator)
+			}
+		}
+	}
+	users, err := b.getUsers(creatorIds)
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := b.loadPreferences()
+	if err != nil {
+		return nil, err
+	}
+	notes := make([]string, len(counts))
+	for i, count := range counts {
+		var aliases []string
+		for alias := range count.aliases {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		var parts []string
+		for _, alias := range aliases {
+			part := fmt.Sprintf(":%s:", alias)
+			// The alias creator is named without an @, since they are not the one being congratulated.
+			if user, ok := users[count.aliases[alias]]; ok && !prefs.isSkipped(user) {
+				part += " by " + user.RealName
+			}
+			parts = append(parts, part)
+		}
+		if len(parts) == 1 {
+			notes[i] = fmt.Sprintf(" (including the votes for the alias %s)", parts[0])
+		} else if len(parts) > 1 {
+			notes[i] = fmt.Sprintf(" (including the votes for the aliases %s)", strings.Join(parts, ", "))
+		}
+	}
+	return notes, nil
+}
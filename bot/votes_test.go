@@ -0,0 +1,308 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryho/slack-emoji-bot/fakeslack"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+func TestVotesForAnAliasCountForTheOriginal(t *testing.T) {
+	b, server := setupWeekly(t)
+	b.config.NoteAliasCreators = true
+	addEmoji(server, "new-one", "U1", 2*24*time.Hour)
+	server.AddEmoji(
+		fakeslack.Emoji{Name: "vintage", IsAlias: 1, AliasFor: "old-emoji", Created: int(time.Now().Add(-20 * 24 * time.Hour).Unix()), UserId: "U3"},
+		fakeslack.Emoji{Name: "fiesta", IsAlias: 1, AliasFor: "new-one", Created: int(time.Now().Add(-24 * time.Hour).Unix()), UserId: "U2"},
+	)
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	voteTS := state.lastRun().VoteMessageTS
+	for name, users := range map[string][]string{
+		"new-one": {"U1", "U2"},
+		// U2 voted for new-one already, so only U3 adds a vote.
+		"fiesta":  {"U2", "U3"},
+		"vintage": {"U1", "U2", "U3"},
+		// A standard emoji, which nobody uploaded.
+		"thumbsup": {"U1", "U2", "U3"},
+	} {
+		err = server.AddReaction(testChannelId, voteTS, name, users...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	addEmoji(server, "new-two", "U3", time.Hour)
+
+	b.resetRunState()
+	err = b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	winners := findPosted(t, postedTo(server, b.config.EmojiChannel), "*Congratulations*")
+	for _, want := range []string{
+		"1. User U1 (<@U1>) :new-one: 3 (including the votes for the alias :fiesta: by User U2)",
+		"1. User U1 (<@U1>) :old-emoji: 3 (including the votes for the alias :vintage: by User U3)",
+	} {
+		if !strings.Contains(winners, want) {
+			t.Errorf("%q is not in %q", want, winners)
+		}
+	}
+	if strings.Contains(winners, "thumbsup") || strings.Contains(winners, "<@U2>") || strings.Contains(winners, "<@U3>") {
+		t.Errorf("a standard emoji or an alias creator was credited in %q", winners)
+	}
+
+	results, err := b.voteResults(time.Time{}, b.now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected one vote result, got %+v", results)
+	}
+	for _, votes := range results[0].Votes {
+		if votes.Emoji == "fiesta" && (votes.AliasFor != "new-one" || votes.UserId != "U1") {
+			t.Errorf("the votes for an alias were saved as %+v", votes)
+		}
+	}
+}
+
+func TestVoteRulesLeaveOutVotes(t *testing.T) {
+	b, server := setupWeekly(t)
+	server.AddUser(slack.User{ID: fakeslack.BotUserID, Name: "emoji-bot", RealName: "Emoji Bot"})
+	addEmoji(server, "new-one", "U1", 3*24*time.Hour)
+	addEmoji(server, "new-two", "U2", 2*24*time.Hour)
+	addEmoji(server, "new-three", "U1", 24*time.Hour)
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	voteTS := state.lastRun().VoteMessageTS
+	for _, reaction := range []struct {
+		name  string
+		users []string
+	}{
+		{"new-one", []string{"U1", "U2", "U3", fakeslack.BotUserID}},
+		{"new-two", []string{"U1", "U2", "U3"}},
+		{"new-three", []string{"U2", "U3"}},
+		{"old-emoji", []string{"U1", "U2", "U3"}},
+	} {
+		err = server.AddReaction(testChannelId, voteTS, reaction.name, reaction.users...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	addEmoji(server, "new-four", "U3", time.Hour)
+
+	b.config.RunMode = MODE__DM_FOR_REVIEW
+	b.config.MinVotes = 2
+	b.config.OnlyVotesForNewEmojis = true
+	b.config.IgnoreSelfVotes = true
+	b.config.MaxVotesPerVoter = 2
+	b.resetRunState()
+	err = b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posted := postedTo(server, "UOWNER")
+	winners := findPosted(t, posted, "*Congratulations*")
+	for _, want := range []string{
+		"(sorted by emoji reactions from 3 voters)",
+		"1. User U1 (@u1) :new-one: 2",
+		"1. User U2 (@u2) :new-two: 2",
+	} {
+		if !strings.Contains(winners, want) {
+			t.Errorf("%q is not in %q", want, winners)
+		}
+	}
+	if strings.Contains(winners, "new-three") || strings.Contains(winners, "old-emoji") {
+		t.Errorf("an emoji without enough counted votes won in %q", winners)
+	}
+	excluded := findPosted(t, posted, "Votes that were not counted")
+	for _, want := range []string{
+		"*Reactions from the bot:*\nEmoji Bot: :new-one:",
+		"*Not one of the new emojis that were up for the vote:*\nUser U1: :old-emoji:\nUser U2: :old-emoji:\nUser U3: :old-emoji:",
+		"*Votes for their own emoji:*\nUser U1: :new-one:\nUser U2: :new-two:",
+		"*Over the limit of votes per person:*\nUser U3: :new-three:",
+	} {
+		if !strings.Contains(excluded, want) {
+			t.Errorf("%q is not in %q", want, excluded)
+		}
+	}
+}
+
+func TestEqualVoterWeightSplitsVotes(t *testing.T) {
+	b, _ := setupWeekly(t)
+	b.config.EqualVoterWeight = true
+	emojis := &SlackEmojiResponseMessage{emojiMap: map[string]*Emoji{
+		"busy":  {Name: "busy", UserId: "U1"},
+		"quiet": {Name: "quiet", UserId: "U2"},
+		"tied":  {Name: "tied", UserId: "U3"},
+	}}
+	message := &slack.Message{Msg: slack.Msg{Timestamp: tsAgo(time.Hour), Reactions: []slack.ItemReaction{
+		{Name: "busy", Count: 2, Users: []string{"U1", "U2"}},
+		{Name: "quiet", Count: 1, Users: []string{"U1"}},
+		{Name: "tied", Count: 1, Users: []string{"U1"}},
+	}}}
+	tally, err := b.countVotes(b.emojiResolver(emojis), 0, []*slack.Message{message})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// U1 split their vote three ways, and U2 only voted for busy.
+	var got []string
+	for _, emoji := range tally.emojis {
+		got = append(got, emoji.name+" "+b.formatVotes(emoji))
+	}
+	want := "busy 1.3, quiet 0.3, tied 0.3"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("got %v, expected %v", strings.Join(got, ", "), want)
+	}
+	if tally.voters != 2 || tally.emojis[0].Votes != 2 {
+		t.Errorf("unexpected tally %+v", tally)
+	}
+}
+
+func TestRankedChoiceUsesTheReactionTimeline(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 3*24*time.Hour)
+	addEmoji(server, "new-two", "U2", 2*24*time.Hour)
+	addEmoji(server, "new-three", "U3", 24*time.Hour)
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	voteTS := state.lastRun().VoteMessageTS
+
+	// The reactions are on the prompt in the order that each emoji was first reacted with, but each person
+	// put them in a different order.
+	for _, reaction := range []struct {
+		name  string
+		users []string
+	}{
+		{"new-one", []string{"U1", "U2"}},
+		{"new-two", []string{"U1", "U3"}},
+		{"new-three", []string{"U2", "U3"}},
+	} {
+		err = server.AddReaction(testChannelId, voteTS, reaction.name, reaction.users...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	for i, event := range []struct {
+		user, reaction string
+		removed        bool
+	}{
+		{"U1", "new-one", false},
+		{"U1", "new-one", true},
+		{"U1", "new-two", false},
+		// Adding it again moves it after new-two.
+		{"U1", "new-one", false},
+		{"U2", "new-three", false},
+		{"U2", "new-one", false},
+		{"U3", "new-two", false},
+		{"U3", "new-three", false},
+	} {
+		reaction := &slackevents.ReactionAddedEvent{
+			User:           event.user,
+			Reaction:       event.reaction,
+			Item:           slackevents.Item{Type: "message", Channel: testChannelId, Timestamp: voteTS},
+			EventTimestamp: fmt.Sprintf("%d.000100", start.Add(time.Duration(i)*time.Minute).Unix()),
+		}
+		err = b.handleReaction(reaction, event.removed)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Reactions on other messages are not saved.
+	err = b.handleReaction(&slackevents.ReactionAddedEvent{
+		User:     "U1",
+		Reaction: "new-three",
+		Item:     slackevents.Item{Type: "message", Channel: testChannelId, Timestamp: "1.000000"},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addEmoji(server, "new-four", "U3", time.Hour)
+
+	b.config.VoteTally = VOTE_TALLY__RANKED_CHOICE
+	b.config.MinVotes = 1
+	b.resetRunState()
+	err = b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// new-one is nobody's first pick and is out first, and then new-three, so new-two wins.
+	winners := findPosted(t, postedTo(server, b.config.EmojiChannel), "*Congratulations*")
+	for _, want := range []string{
+		"1. User U2 (<@U2>) :new-two: 2",
+		"2. User U3 (<@U3>) :new-three: 1",
+	} {
+		if !strings.Contains(winners, want) {
+			t.Errorf("%q is not in %q", want, winners)
+		}
+	}
+	if strings.Contains(winners, "new-one") {
+		t.Errorf("the emoji with no first picks won in %q", winners)
+	}
+}
+
+func TestReviewersAreToldWhenTheVoteOrderIsNotKnown(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 2*24*time.Hour)
+	addEmoji(server, "new-two", "U2", 24*time.Hour)
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	voteTS := state.lastRun().VoteMessageTS
+	// serve was not running, so there are no reaction events for the prompt.
+	for name, users := range map[string][]string{
+		"new-one": {"U1", "U2", "U3"},
+		"new-two": {"U1", "U2"},
+	} {
+		err = server.AddReaction(testChannelId, voteTS, name, users...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	addEmoji(server, "new-three", "U3", time.Hour)
+
+	b.config.RunMode = MODE__DM_FOR_REVIEW
+	b.config.VoteTally = VOTE_TALLY__PLURALITY
+	b.resetRunState()
+	err = b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	note := findPosted(t, postedTo(server, "UOWNER"), "The order of some votes is not known")
+	if !strings.Contains(note, "when 2 people added") {
+		t.Errorf("expected U1 and U2 to be counted in %q", note)
+	}
+}
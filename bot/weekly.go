@@ -0,0 +1,306 @@
+package bot
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// RunWeekly runs the weekly pipeline: last week's votes, new emojis, uploaders, the meme counter and longest names.
+// If the last run failed part way, this resumes it instead, without posting what it posted again.
+func (b *Bot) RunWeekly() error {
+	return b.runWeekly(false)
+}
+
+// RedoWeekly runs the last weekly run again, editing the messages that it posted instead of posting new ones.
+// The messages that are not needed anymore are deleted.
+func (b *Bot) RedoWeekly() error {
+	return b.runWeekly(true)
+}
+
+func (b *Bot) runWeekly(redo bool) error {
+	return b.report("weekly", func() error {
+		err := b.startJournal(redo)
+		if err != nil {
+			return err
+		}
+		// This will get the last new emoji.
+		err = b.startRun()
+		if err != nil {
+			return err
+		}
+
+		var allEmojis *SlackEmojiResponseMessage
+		if !b.config.FastMode || b.config.DoEmojisWrapped {
+			allEmojis, err = b.allEmojis()
+			if err != nil {
+				return err
+			}
+		} else {
+			allEmojis, err = b.getEmojisBackTo(b.previousLastNewEmoji, b.previousLastNewEmojiCreated)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !b.config.SkipTopEmojisByReactionVote {
+			err = b.runStep("last_week_votes", func() error {
+				if b.reactionMessage == nil {
+					fmt.Fprintln(b.out, "There is no vote prompt from last week, skipping the top emojis from last week.")
+					return nil
+				}
+				return b.printTopEmojisByReactionVote(allEmojis, 0, 10, b.reactionMessage)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if b.config.DoEmojisWrapped {
+			err = b.runStep("wrapped", func() error {
+				return b.emojisWrapped(allEmojis, b.DefaultWrappedYear())
+			})
+			if err != nil {
+				return err
+			}
+			return b.finishJournal()
+		}
+
+		// cacheEmojiImages and detectDeletedEmojis should be called before removeSkippedEmojis
+		err = b.cacheEmojiImages(allEmojis)
+		if err != nil {
+			return err
+		}
+
+		// Detecting deleted emojis by comparing snapshots is not possible in fast mode,
+		// but the emojis that the serve command saw removed are still reported.
+		err = b.runStep("deleted", func() error {
+			return b.detectDeletedEmojis(allEmojis, !b.config.FastMode)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = b.removeSkippedEmojis(allEmojis)
+		if err != nil {
+			return err
+		}
+
+		if b.config.DetectDuplicateImages {
+			err = b.runStep("duplicates", func() error {
+				return b.duplicateImages(allEmojis)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		// mostRecentEmojis, topUploaders, and longestEmojis should be called after removeSkippedEmojis
+		err = b.runStep("new_emojis", func() error {
+			return b.mostRecentEmojis(allEmojis)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = b.runStep("uploaders", func() error {
+			return b.topAndNewUploaders(allEmojis)
+		})
+		if err != nil {
+			return err
+		}
+
+		if b.config.DoHeBringsYouCounter {
+			err = b.runStep("meme_counter", func() error {
+				return b.memeCounter(allEmojis)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if b.config.FindLongestEmojisAllTime {
+			err = b.runStep("longest", func() error {
+				return b.longestEmojis(allEmojis)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		// Only runs that really posted to the channel are remembered. Reports for a
+		// window from --since and --until are not where the next run should resume.
+		if b.recordsRuns() {
+			b.thisRun.ID = b.journal.ID
+			err = b.recordRun(b.thisRun)
+			if err != nil {
+				return err
+			}
+		}
+		return b.finishJournal()
+	})
+}
+
+const (
+	// How many emojis are in one row of the new emoji grid.
+	emojisPerRow              = 23
+	maxPeopleForTopUploaders  = 100
+	maxEmojisForLongestEmojis = 100
+	maxCharactersPerMessage   = 10000
+	TopPeopleToPrint          = 5
+
+	lastWeek                  = ":trophy: *Congratulations* to the top new emojis from last week (sorted by emoji reactions from %v voters):\n"
+	lastYear                  = ":trophy::trophy::trophy: *CONGRATULATIONS TO THE TOP EMOJIS OF %v!!!* (sorted by emoji reactions from %v voters):\n"
+	introMessage              = ":new-shine: Here are all the new emojis! There are %v new emojis from %v people."
+	introMessageNoUploaders   = ":new-shine: Here are all the new emojis! There are %v new emojis."
+	votePrompt                = ":votesticker: *Vote for the best new emoji of the week by reacting here!*"
+	votePromptPrevious        = "Vote for the best new emoji of the week by reacting here!"
+	topAllTimeMessage         = ":tophat: Top Emoji Uploaders of All Time:"
+	topThisWeekMessage        = ":rocket: Top Emoji Uploaders This Week:"
+	topSecondMessage          = "More Top Emoji Uploaders:"
+	newUploadersMessage       = ":welcome: *Welcome* to %d New Emoji Uploaders!"
+	newUploadersSecondMessage = "More New Emoji Uploaders:"
+	moreTopCreatorsMessage    = "More Top Uploaders"
+	muteMessage               = "If you do not want to be pinged by this bot, message @%s to request that you be added to the mute list so the script prints your name without the @ sign.\n"
+	skipMessage               = "If you want to be excluded from the bot all together, you can ask @%s to add you to the skip list.\n"
+	muteMessageSelfService    = "If you do not want to be pinged by this bot, send me a DM saying \"mute me\" and I will print your name without the @ sign.\n"
+	skipMessageSelfService    = "If you want to be excluded from the bot all together, send me a DM saying \"skip me\".\n"
+)
+
+func (b *Bot) mostRecentEmojis(response *SlackEmojiResponseMessage) error {
+	lastNewEmojiSanitized := strings.ReplaceAll(b.lastNewEmoji, ":", "")
+	newEmojiList, foundLastEmoji := b.newEmojis(response)
+	response.peopleThisWeek = countUploaders(newEmojiList)
+	b.thisRun.StartEmoji = lastNewEmojiSanitized
+	b.thisRun.StartEmojiCreated = b.lastNewEmojiCreated
+	if startEmoji, ok := response.emojiMap[lastNewEmojiSanitized]; ok && b.lastNewEmojiCreated == 0 {
+		b.thisRun.StartEmojiCreated = int64(startEmoji.Created)
+	}
+	b.thisRun.LastNewEmoji = b.thisRun.StartEmoji
+	b.thisRun.LastNewEmojiCreated = b.thisRun.StartEmojiCreated
+	if len(newEmojiList) > 0 {
+		b.thisRun.LastNewEmoji = newEmojiList[0].Name
+		b.thisRun.LastNewEmojiCreated = int64(newEmojiList[0].Created)
+	}
+	if skipped := b.newestSkippedEmoji; skipped != nil && int64(skipped.Created) > b.thisRun.LastNewEmojiCreated {
+		b.thisRun.LastNewEmoji = skipped.Name
+		b.thisRun.LastNewEmojiCreated = int64(skipped.Created)
+	}
+	var allNewEmojis []string
+	for _, emoji := range newEmojiList {
+		allNewEmojis = append(allNewEmojis, emoji.Name)
+	}
+	if !foundLastEmoji {
+		fmt.Fprintf(b.out, "Did not find the last emoji %v. This is probably a problem.\n", b.lastNewEmoji)
+	}
+
+	// Oldest first.
+	var gridEmojis []string
+	auditMessage := []string{""}
+	for z := len(allNewEmojis) - 1; z >= 0; z-- {
+		emojiName := allNewEmojis[z]
+		if b.config.AprilFoolsMode {
+			emojiName = b.config.AprilFoolsEmoji
+		}
+		newPart := ":" + emojiName + ": " + emojiName + "\n"
+		if len(newPart)+len(auditMessage[len(auditMessage)-1]) > maxCharactersPerMessage {
+			auditMessage = append(auditMessage, newPart)
+		} else {
+			auditMessage[len(auditMessage)-1] += newPart
+		}
+		gridEmojis = append(gridEmojis, emojiName)
+	}
+
+	intro := b.printer.Sprintf(introMessage, len(allNewEmojis), len(response.peopleThisWeek))
+	if !b.emojiSource.HasUploaders() {
+		intro = b.printer.Sprintf(introMessageNoUploaders, len(allNewEmojis))
+	}
+	_, err := b.printMessages(MSG_TYPE__SEND_AND_REVIEW, renderEmojiGrid(intro, gridEmojis, emojisPerRow), "")
+	if err != nil {
+		return err
+	}
+	var peopleNameArray []string
+	for _, person := range response.peopleThisWeek {
+		peopleNameArray = append(peopleNameArray, person.name)
+	}
+
+	threadId, err := b.printRendered(MSG_TYPE__SEND, renderVotePrompt(), "")
+	if err != nil {
+		return err
+	}
+	b.thisRun.VoteMessageTS = threadId
+	// Side by side message
+	for _, part := range auditMessage {
+		_, err := b.printMessageWithThreadId(MSG_TYPE__SEND, part, threadId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !b.emojiSource.HasUploaders() {
+		// The uploaders are not known, so there is nobody to thank.
+		return nil
+	}
+
+	// List everyone's names
+	_, err = b.printMessageWithThreadId(MSG_TYPE__SEND, createNameString(peopleNameArray), threadId)
+	if err != nil {
+		return err
+	}
+
+	return b.printTopPeople(topThisWeekMessage, topSecondMessage, response.peopleThisWeek, math.MaxInt64, false)
+}
+
+// newEmojis returns the emojis uploaded after the last new emoji, newest first. When the upload time of
+// the last new emoji is known, that is used. Otherwise the emojis up to the one with its name are new.
+// With --until, emojis uploaded after that are left out.
+func (b *Bot) newEmojis(response *SlackEmojiResponseMessage) ([]*Emoji, bool) {
+	lastNewEmojiSanitized := strings.ReplaceAll(b.lastNewEmoji, ":", "")
+	sort.Sort(EmojiUploadDateSort(response.Emoji))
+	var newEmojiList []*Emoji
+	for _, emoji := range response.Emoji {
+		if b.lastNewEmojiCreated != 0 {
+			if int64(emoji.Created) <= b.lastNewEmojiCreated {
+				return newEmojiList, true
+			}
+		} else if emoji.Name == lastNewEmojiSanitized {
+			return newEmojiList, true
+		}
+		if !b.reportUntil.IsZero() && int64(emoji.Created) > b.reportUntil.Unix() {
+			continue
+		}
+		newEmojiList = append(newEmojiList, emoji)
+	}
+	// Every emoji is new if there is nothing to stop at.
+	return newEmojiList, b.lastNewEmojiCreated == 0 && lastNewEmojiSanitized == ""
+}
+
+type EmojiUploadDateSort []*Emoji
+
+func (p EmojiUploadDateSort) Len() int           { return len(p) }
+func (p EmojiUploadDateSort) Less(i, j int) bool { return p[i].Created > p[j].Created }
+func (p EmojiUploadDateSort) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+type EmojiUploadDateSortBackwards []*Emoji
+
+func (p EmojiUploadDateSortBackwards) Len() int           { return len(p) }
+func (p EmojiUploadDateSortBackwards) Less(i, j int) bool { return p[i].Created < p[j].Created }
+func (p EmojiUploadDateSortBackwards) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+type ByCount []*stringCount
+
+func (a ByCount) Len() int { return len(a) }
+func (a ByCount) Less(i, j int) bool {
+	if a[i].count == a[j].count {
+		return a[i].name < a[j].name
+	}
+	return a[i].count > a[j].count
+}
+func (a ByCount) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+
+type stringCount struct {
+	count int
+	name  string
+	id    string
+}
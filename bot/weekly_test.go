@@ -0,0 +1,273 @@
+package bot
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryho/slack-emoji-bot/fakeslack"
+
+	"github.com/slack-go/slack"
+)
+
+const testChannelId = "C0EMOJIS"
+
+// setupWeekly makes a bot for a fake Slack with an emoji channel, three users and an emoji from a month ago.
+func setupWeekly(t *testing.T) (*Bot, *fakeslack.Server) {
+	home := t.TempDir()
+	err := os.Mkdir(filepath.Join(home, "Documents"), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+
+	server := fakeslack.New()
+	t.Cleanup(server.Close)
+	server.AddChannel(testChannelId, "emojis")
+	for _, id := range []string{"U1", "U2", "U3"} {
+		user := slack.User{ID: id, Name: strings.ToLower(id), RealName: "User " + id}
+		server.AddUser(user)
+	}
+	server.AddUser(slack.User{ID: "UOWNER", Name: "owner", RealName: "Owner"})
+	addEmoji(server, "old-emoji", "U1", 30*24*time.Hour)
+
+	config := DefaultConfig()
+	config.OwnerLDAP = "owner"
+	config.OwnerUserId = "UOWNER"
+	config.BotOauthToken = "xoxb-test"
+	config.WorkspaceDomain = "test"
+	config.OwnerUserOauthToken = "xoxc-test"
+	config.RunMode = MODE__FULL_SEND
+	b, err := New(config,
+		WithSlackClient(slack.New(config.BotOauthToken, slack.OptionAPIURL(server.APIURL()))),
+		WithEmojiSource(&adminListSource{url: server.AdminListURL(), token: config.OwnerUserOauthToken, cookie: "d=test", client: &http.Client{Timeout: 10 * time.Second}}),
+		WithOutput(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	// Rate limits are still counted, but the test does not wait for them.
+	b.retrier.sleep = func(time.Duration) {}
+	return b, server
+}
+
+func addEmoji(server *fakeslack.Server, name, userId string, age time.Duration) {
+	server.AddEmoji(fakeslack.Emoji{
+		Name:            name,
+		Url:             "https://emoji.example.com/" + name + ".png",
+		Created:         int(time.Now().Add(-age).Unix()),
+		UserId:          userId,
+		UserDisplayName: "User " + userId,
+	})
+}
+
+func postedTo(server *fakeslack.Server, channel string) []string {
+	var texts []string
+	for _, message := range server.Posted() {
+		if message.Channel == channel {
+			texts = append(texts, message.Text)
+		}
+	}
+	return texts
+}
+
+func findPosted(t *testing.T, texts []string, want string) string {
+	t.Helper()
+	for _, text := range texts {
+		if strings.Contains(text, want) {
+			return text
+		}
+	}
+	t.Fatalf("no message contains %q, the messages were:\n%v", want, strings.Join(texts, "\n---\n"))
+	return ""
+}
+
+func TestWeeklyFirstRun(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 2*24*time.Hour)
+	addEmoji(server, "new-two", "U2", 24*time.Hour)
+
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posted := postedTo(server, b.config.EmojiChannel)
+	findPosted(t, posted, "There are 2 new emojis from 2 people")
+	findPosted(t, posted, ":new-one::new-two:")
+	findPosted(t, posted, votePrompt)
+	for _, text := range posted {
+		if strings.Contains(text, "old-emoji") {
+			t.Errorf("the emoji from before the first week was posted: %q", text)
+		}
+	}
+
+	state, err := b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := state.lastRun()
+	if run == nil {
+		t.Fatal("the run was not saved")
+	}
+	if run.LastNewEmoji != "new-two" || run.VoteChannelID != testChannelId || run.VoteMessageTS == "" {
+		t.Errorf("unexpected saved run %+v", run)
+	}
+}
+
+func TestWeeklyCountsLastWeekVotes(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 2*24*time.Hour)
+	addEmoji(server, "new-two", "U2", 24*time.Hour)
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	voteTS := state.lastRun().VoteMessageTS
+	err = server.AddReaction(testChannelId, voteTS, "new-one", "U1", "U2", "U3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.AddReaction(testChannelId, voteTS, "new-two", "U3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addEmoji(server, "new-three", "U3", time.Hour)
+
+	b.resetRunState()
+	err = b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posted := postedTo(server, b.config.EmojiChannel)
+	winners := findPosted(t, posted, "*Congratulations*")
+	if !strings.Contains(winners, "(sorted by emoji reactions from 3 voters)") {
+		t.Errorf("wrong voter count in %q", winners)
+	}
+	if !strings.Contains(winners, "1. User U1 (<@U1>) :new-one: 3") {
+		t.Errorf("the uploader of the winner was not credited in %q", winners)
+	}
+	if strings.Contains(winners, "new-two") {
+		t.Errorf("an emoji with fewer than %d votes won in %q", minReactions, winners)
+	}
+	findPosted(t, posted, "There are 1 new emojis from 1 people")
+	findPosted(t, posted, ":new-three:")
+
+	state, err = b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Runs) != 2 || state.lastRun().StartEmoji != "new-two" || state.lastRun().LastNewEmoji != "new-three" {
+		t.Errorf("unexpected saved runs %+v", state.Runs)
+	}
+}
+
+func TestWeeklyGoesOnWithoutADeletedVotePrompt(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 24*time.Hour)
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = b.slack.DeleteMessage(testChannelId, state.lastRun().VoteMessageTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addEmoji(server, "new-two", "U2", time.Hour)
+
+	b.resetRunState()
+	err = b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posted := postedTo(server, b.config.EmojiChannel)
+	findPosted(t, posted, ":new-two:")
+	for _, text := range posted {
+		if strings.Contains(text, "*Congratulations*") {
+			t.Errorf("posted the winners of a deleted vote prompt: %q", text)
+		}
+	}
+}
+
+func TestWeeklyResumesFromChannelWithoutState(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 2*24*time.Hour)
+	addEmoji(server, "new-two", "U2", 24*time.Hour)
+	// What an older version of the bot posted, before it saved its state.
+	server.AddMessage(testChannelId, slack.Message{Msg: slack.Msg{Text: ":old-emoji:", Timestamp: tsAgo(8 * 24 * time.Hour)}})
+	voteTS := server.AddMessage(testChannelId, slack.Message{Msg: slack.Msg{Text: votePrompt, Timestamp: tsAgo(7 * 24 * time.Hour)}})
+	err := server.AddReaction(testChannelId, voteTS, "old-emoji", "U1", "U2", "U3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posted := postedTo(server, b.config.EmojiChannel)
+	findPosted(t, posted, ":old-emoji: 3")
+	findPosted(t, posted, ":new-one::new-two:")
+}
+
+func TestWeeklyWaitsOutRateLimits(t *testing.T) {
+	b, server := setupWeekly(t)
+	addEmoji(server, "new-one", "U1", 24*time.Hour)
+	server.RateLimit("chat.postMessage", 1)
+
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posted := postedTo(server, b.config.EmojiChannel)
+	findPosted(t, posted, "There are 1 new emojis from 1 people")
+	if calls := server.Calls("chat.postMessage"); calls != len(server.Posted())+1 {
+		t.Errorf("expected one retried call, got %d calls for %d messages", calls, len(server.Posted()))
+	}
+}
+
+func TestWeeklyReviewModeOnlyMessagesReviewers(t *testing.T) {
+	b, server := setupWeekly(t)
+	b.config.RunMode = MODE__DM_FOR_REVIEW
+	addEmoji(server, "new-one", "U1", 24*time.Hour)
+
+	err := b.RunWeekly()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if posted := postedTo(server, b.config.EmojiChannel); len(posted) != 0 {
+		t.Errorf("review mode posted to the channel: %v", posted)
+	}
+	findPosted(t, postedTo(server, b.config.OwnerUserId), "There are 1 new emojis from 1 people")
+	state, err := b.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Runs) != 0 {
+		t.Errorf("review mode saved a run: %+v", state.Runs)
+	}
+}
+
+func tsAgo(age time.Duration) string {
+	return strconv.FormatInt(time.Now().Add(-age).Unix(), 10) + ".000100"
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ryho/slack-emoji-bot/bot"
+)
+
+type command struct {
+	name        string
+	description string
+	// addFlags registers the flags that only this command accepts.
+	addFlags func(flags *flag.FlagSet)
+	run      func(b *bot.Bot) error
+	// With several workspaces, commands run for one workspace after another, unless they keep
+	// running. Those run for every workspace at the same time.
+	keepsRunning bool
+}
+
+func allCommands() []*command {
+	var year int
+	var allTime, force, redo bool
+	var cutoff, from, to, output string
+	return []*command{
+		{
+			name:        "init",
+			description: "Set up the first run, so that it only posts the emojis uploaded after a cutoff.",
+			addFlags: func(flags *flag.FlagSet) {
+				flags.StringVar(&cutoff, "cutoff", "", "A date like 2025-01-31 or an age like 7d. Asks when not set.")
+				flags.BoolVar(&force, "force", false, "Start over even if the bot already has state.")
+			},
+			run: func(b *bot.Bot) error {
+				if cutoff == "" {
+					hasState, err := b.HasState()
+					if err != nil {
+						return err
+					}
+					// Without -force, RunInit refuses to start over, so there is no point in asking.
+					if !hasState || force {
+						cutoff, err = promptForCutoff()
+						if err != nil {
+							return err
+						}
+					}
+				}
+				return b.RunInit(cutoff, force)
+			},
+		},
+		{
+			name:        "weekly",
+			description: "Run the weekly pipeline: last week's votes, new emojis, uploaders, meme counter and longest names.",
+			addFlags: func(flags *flag.FlagSet) {
+				flags.BoolVar(&redo, "redo", false, "Run the last weekly run again, editing the messages that it posted instead of posting new ones.")
+			},
+			run: func(b *bot.Bot) error {
+				if redo {
+					return b.RedoWeekly()
+				}
+				return b.RunWeekly()
+			},
+		},
+		{
+			name:        "wrapped",
+			description: "Post Emojis Wrapped, the top voted emojis of a year.",
+			addFlags: func(flags *flag.FlagSet) {
+				flags.IntVar(&year, "year", 0, "The year to summarize. Defaults to the previous year in January, and this year otherwise.")
+			},
+			run: func(b *bot.Bot) error {
+				if year == 0 {
+					year = b.DefaultWrappedYear()
+				}
+				return b.RunWrapped(year)
+			},
+		},
+		{
+			name:        "deleted",
+			description: "Report the emojis deleted since the last emoji snapshot.",
+			run:         (*bot.Bot).RunDeleted,
+		},
+		{
+			name:        "diff",
+			description: "Report the emojis that were added, deleted, re-uploaded, renamed or re-aliased between two emoji snapshots.",
+			addFlags: func(flags *flag.FlagSet) {
+				flags.StringVar(&from, "from", "", "The snapshot file, or a date like 2025-01-31 or an age like 7d for the snapshot at that time. Defaults to the snapshot before --to.")
+				flags.StringVar(&to, "to", "", "Like --from, or now to download every emoji. Defaults to the last snapshot.")
+				flags.StringVar(&output, "output", "", "Write the changes to this Markdown file, or HTML file if it ends in .html, instead of DMing the reviewers.")
+			},
+			run: func(b *bot.Bot) error { return b.RunDiff(from, to, output) },
+		},
+		{
+			name:        "longest",
+			description: "Print the longest emoji names.",
+			run:         (*bot.Bot).RunLongest,
+		},
+		{
+			name:        "top-uploaders",
+			description: "Post the top emoji uploaders of the week.",
+			addFlags: func(flags *flag.FlagSet) {
+				flags.BoolVar(&allTime, "all-time", false, "Post the top emoji uploaders of all time instead.")
+			},
+			run: func(b *bot.Bot) error { return b.RunTopUploaders(allTime) },
+		},
+		{
+			name:         "serve",
+			description:  "Keep running and run weekly and wrapped on the schedules from the config file.",
+			keepsRunning: true,
+			run: func(b *bot.Bot) error {
+				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				return b.Serve(ctx)
+			},
+		},
+	}
+}
+
+// These flags are accepted by every command and override values from the config file.
+type commonFlags struct {
+	configFile string
+	workspace  string
+	mode       string
+	channel    string
+	since      string
+	until      string
+}
+
+func addCommonFlags(flags *flag.FlagSet) *commonFlags {
+	common := &commonFlags{}
+	flags.StringVar(&common.configFile, "config", "config.json", "Path to the config file. See example/config.json.")
+	flags.StringVar(&common.workspace, "workspace", "", "Only run for the workspace with this name. By default the command runs for every workspace in the config file.")
+	flags.StringVar(&common.mode, "mode", "", "Overrides run_mode. One of print_everything, dm_for_review, dm_for_testing or full_send.")
+	flags.StringVar(&common.channel, "channel", "", "Overrides emoji_channel.")
+	flags.StringVar(&common.since, "since", "", "Only emojis uploaded after this are new. A date like 2025-01-31, an age like 7d, "+
+		"or an emoji name like :emoji: which overrides override_last_new_emoji.")
+	flags.StringVar(&common.until, "until", "", "Only emojis uploaded before this are new. A date like 2025-01-31 or an age like 7d.")
+	return common
+}
+
+// newBots loads the config file and makes a bot for every workspace that the command runs for.
+func (c *commonFlags) newBots() ([]*bot.Bot, error) {
+	configs, err := bot.LoadWorkspaces(c.configFile)
+	if err != nil {
+		return nil, err
+	}
+	var bots []*bot.Bot
+	for _, conf := range configs {
+		if c.workspace != "" && conf.Name != c.workspace {
+			continue
+		}
+		var out io.Writer = os.Stdout
+		if len(configs) > 1 {
+			// Tell the output of the workspaces apart.
+			out = &prefixWriter{w: os.Stdout, prefix: "[" + conf.Name + "] "}
+		}
+		b, err := c.newBot(conf, out)
+		if err != nil {
+			return nil, fmt.Errorf("workspace %v: %w", conf.Name, err)
+		}
+		bots = append(bots, b)
+	}
+	if len(bots) == 0 {
+		return nil, fmt.Errorf("there is no workspace named %q in %v", c.workspace, c.configFile)
+	}
+	return bots, nil
+}
+
+// newBot applies the flags to the config of a workspace and makes its bot.
+func (c *commonFlags) newBot(conf *bot.Config, out io.Writer) (*bot.Bot, error) {
+	var err error
+	if c.mode != "" {
+		conf.RunMode, err = bot.ParseMode(c.mode)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.channel != "" {
+		if c.channel != conf.EmojiChannel {
+			// The cached ID belongs to the channel from the config file.
+			conf.CachedChannelID = ""
+		}
+		conf.EmojiChannel = c.channel
+	}
+	now := time.Now()
+	location, err := conf.Location()
+	if err != nil {
+		return nil, err
+	}
+	var reportSince, reportUntil time.Time
+	if c.since != "" {
+		if len(c.since) > 2 && strings.HasPrefix(c.since, ":") && strings.HasSuffix(c.since, ":") {
+			conf.OverRideLastNewEmoji = strings.Trim(c.since, ":")
+		} else {
+			reportSince, err = bot.ParseCutoff(c.since, now, location)
+			if err != nil {
+				return nil, fmt.Errorf("--since: %w", err)
+			}
+		}
+	}
+	if c.until != "" {
+		reportUntil, err = bot.ParseCutoff(c.until, now, location)
+		if err != nil {
+			return nil, fmt.Errorf("--until: %w", err)
+		}
+		if !reportSince.IsZero() && !reportUntil.After(reportSince) {
+			return nil, fmt.Errorf("--until %v is not after --since %v", c.until, c.since)
+		}
+	}
+	b, err := bot.New(conf, bot.WithOutput(out))
+	if err != nil {
+		return nil, err
+	}
+	b.SetReportWindow(reportSince, reportUntil)
+	return b, nil
+}
+
+// runCommandLine runs a command like "emojibot wrapped --year 2025". With no command, weekly is run.
+func runCommandLine(args []string) error {
+	commands := allCommands()
+	commandName := "weekly"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		commandName = args[0]
+		args = args[1:]
+	}
+	if commandName == "help" {
+		printUsage(os.Stdout, commands)
+		return nil
+	}
+	var cmd *command
+	for _, c := range commands {
+		if c.name == commandName {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		printUsage(os.Stderr, commands)
+		return fmt.Errorf("unknown command %q", commandName)
+	}
+
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	common := addCommonFlags(flags)
+	if cmd.addFlags != nil {
+		cmd.addFlags(flags)
+	}
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", strings.Join(flags.Args(), " "))
+	}
+
+	bots, err := common.newBots()
+	if err != nil {
+		return err
+	}
+	defer closeBots(bots)
+	if len(bots) == 1 {
+		return cmd.run(bots[0])
+	}
+	if cmd.keepsRunning {
+		return runTogether(cmd, bots)
+	}
+	// One workspace failing does not stop the others.
+	var failed []string
+	for _, b := range bots {
+		fmt.Printf("Running %v for workspace %v\n", cmd.name, b.Config().Name)
+		err := cmd.run(b)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in workspace %v: %v\n", b.Config().Name, err)
+			failed = append(failed, b.Config().Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%v failed for workspaces %v", cmd.name, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func closeBots(bots []*bot.Bot) {
+	for _, b := range bots {
+		err := b.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to close workspace %v: %v\n", b.Config().Name, err)
+		}
+	}
+}
+
+// runTogether runs the command for every workspace at the same time, and waits until they all stop.
+func runTogether(cmd *command, bots []*bot.Bot) error {
+	errs := make([]error, len(bots))
+	var wg sync.WaitGroup
+	for i, b := range bots {
+		wg.Add(1)
+		go func(i int, b *bot.Bot) {
+			defer wg.Done()
+			errs[i] = cmd.run(b)
+		}(i, b)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("workspace %v: %w", bots[i].Config().Name, err)
+		}
+	}
+	return nil
+}
+
+func printUsage(w io.Writer, commands []*command) {
+	fmt.Fprintf(w, "Usage: emojibot <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-15s %s\n", c.name, c.description)
+	}
+	fmt.Fprintf(w, "\nRun \"emojibot <command> -h\" to see the flags of a command.\n")
+}
+
+func promptForCutoff() (string, error) {
+	fmt.Printf("This is the first run. How far back should the first weekly post go? Enter a date like 2025-01-31 or an age like 7d [%v]: ", bot.DefaultFirstRunCutoff)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		// Stdin is closed, so nobody is there to answer.
+		return bot.DefaultFirstRunCutoff, nil
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return bot.DefaultFirstRunCutoff, nil
+	}
+	return line, nil
+}
+
+// prefixWriter starts every line with a prefix.
+type prefixWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix string
+	// midLine is set when the last write did not end with a new line.
+	midLine bool
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out bytes.Buffer
+	for _, c := range data {
+		if !p.midLine && c != '\n' {
+			out.WriteString(p.prefix)
+		}
+		out.WriteByte(c)
+		p.midLine = c != '\n'
+	}
+	_, err := p.w.Write(out.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
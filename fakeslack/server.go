@@ -0,0 +1,536 @@
+// Package fakeslack is an in-memory Slack server for tests. It implements the Web API methods that
+// the bot uses, with fixtures that tests add before a run and rate limits that tests can inject.
+package fakeslack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// The bot user and bot that post the messages, like Slack sets them on messages posted with a bot token.
+const (
+	BotUserID = "UBOT"
+	BotID     = "BBOT"
+)
+
+// Emoji is an emoji as the emoji.adminList endpoint returns it.
+type Emoji struct {
+	Name            string `json:"name"`
+	IsAlias         int    `json:"is_alias"`
+	AliasFor        string `json:"alias_for"`
+	Url             string `json:"url"`
+	Created         int    `json:"created"`
+	TeamId          string `json:"team_id"`
+	UserId          string `json:"user_id"`
+	UserDisplayName string `json:"user_display_name"`
+}
+
+// PostedMessage is a message that was sent with chat.postMessage.
+type PostedMessage struct {
+	// The channel as it was given, which can be a channel ID, a channel name or a user ID for a DM.
+	Channel  string
+	Text     string
+	ThreadTS string
+	Blocks   string
+	TS       string
+	// Set when the message was changed with chat.update, and then Text and Blocks are the new ones.
+	Edited bool
+	// Set when the message was removed with chat.delete.
+	Deleted bool
+}
+
+type Server struct {
+	server *httptest.Server
+
+	mu         sync.Mutex
+	channels   []slack.Channel
+	history    map[string][]slack.Message
+	users      map[string]slack.User
+	emojis     []Emoji
+	posted     []PostedMessage
+	rateLimits map[string]int
+	failures   map[string]*failure
+	calls      map[string]int
+	handlers   map[string]http.HandlerFunc
+	views      []OpenedView
+	nextTS     int64
+}
+
+// OpenedView is a modal that was opened with views.open.
+type OpenedView struct {
+	TriggerID string
+	View      slack.ModalViewRequest
+}
+
+// New starts a fake Slack server. Call Close when done.
+func New() *Server {
+	s := &Server{
+		history:    map[string][]slack.Message{},
+		users:      map[string]slack.User{},
+		rateLimits: map[string]int{},
+		failures:   map[string]*failure{},
+		calls:      map[string]int{},
+		handlers:   map[string]http.HandlerFunc{},
+		nextTS:     time.Now().Unix(),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// APIURL is the URL to give to slack.OptionAPIURL.
+func (s *Server) APIURL() string {
+	return s.server.URL + "/api/"
+}
+
+// AdminListURL is the URL of the emoji.adminList endpoint.
+func (s *Server) AdminListURL() string {
+	return s.server.URL + "/api/emoji.adminList"
+}
+
+func (s *Server) AddChannel(id, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channel := slack.Channel{}
+	channel.ID = id
+	channel.Name = name
+	channel.IsChannel = true
+	s.channels = append(s.channels, channel)
+}
+
+// AddMessage adds a message to the history of a channel. If the message has no timestamp, the next one is used.
+// It returns the timestamp.
+func (s *Server) AddMessage(channelId string, message slack.Message) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if message.Timestamp == "" {
+		message.Timestamp = s.newTS()
+	}
+	s.addMessage(channelId, message)
+	return message.Timestamp
+}
+
+func (s *Server) addMessage(channelId string, message slack.Message) {
+	messages := append(s.history[channelId], message)
+	// Like Slack, the history is newest first.
+	sort.SliceStable(messages, func(i, j int) bool {
+		return parseTS(messages[i].Timestamp) > parseTS(messages[j].Timestamp)
+	})
+	s.history[channelId] = messages
+}
+
+// AddReaction adds reactions to a message in the history of a channel.
+func (s *Server) AddReaction(channelId, timestamp, name string, userIds ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, message := range s.history[channelId] {
+		if message.Timestamp != timestamp {
+			continue
+		}
+		for j, reaction := range message.Reactions {
+			if reaction.Name == name {
+				s.history[channelId][i].Reactions[j].Users = append(reaction.Users, userIds...)
+				s.history[channelId][i].Reactions[j].Count += len(userIds)
+				return nil
+			}
+		}
+		s.history[channelId][i].Reactions = append(message.Reactions, slack.ItemReaction{Name: name, Count: len(userIds), Users: userIds})
+		return nil
+	}
+	return fmt.Errorf("no message %v in channel %v", timestamp, channelId)
+}
+
+func (s *Server) AddUser(user slack.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.ID] = user
+}
+
+func (s *Server) AddEmoji(emojis ...Emoji) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emojis = append(s.emojis, emojis...)
+}
+
+// RemoveEmoji deletes an emoji, like an admin would.
+func (s *Server) RemoveEmoji(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, emoji := range s.emojis {
+		if emoji.Name == name {
+			s.emojis = append(s.emojis[:i], s.emojis[i+1:]...)
+			return
+		}
+	}
+}
+
+// RateLimit makes the next calls to the method fail with a rate limit error, asking to retry after a second.
+func (s *Server) RateLimit(method string, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimits[method] += times
+}
+
+type failure struct {
+	after      int
+	slackError string
+}
+
+// Fail makes the method fail once with the Slack error, after it succeeded the given number of times.
+func (s *Server) Fail(method string, after int, slackError string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = &failure{after: after, slackError: slackError}
+}
+
+// Handle replaces the handler of a method, for responses that the fixtures can not make.
+func (s *Server) Handle(method string, handler http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = handler
+}
+
+// Calls returns how many times the method was called, including calls that were rate limited.
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// Views returns the modals that were opened, in order.
+func (s *Server) Views() []OpenedView {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]OpenedView(nil), s.views...)
+}
+
+// Posted returns the messages sent with chat.postMessage, oldest first.
+func (s *Server) Posted() []PostedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]PostedMessage(nil), s.posted...)
+}
+
+// History returns the messages in a channel, newest first.
+func (s *Server) History(channelId string) []slack.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]slack.Message(nil), s.history[channelId]...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.calls[method]++
+	if s.rateLimits[method] > 0 {
+		s.rateLimits[method]--
+		s.mu.Unlock()
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	if f, ok := s.failures[method]; ok {
+		if f.after == 0 {
+			delete(s.failures, method)
+			s.mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(errorResponse(f.slackError))
+			return
+		}
+		f.after--
+	}
+	handler, ok := s.handlers[method]
+	s.mu.Unlock()
+	if ok {
+		handler(w, r)
+		return
+	}
+
+	var response interface{}
+	switch method {
+	case "conversations.list":
+		response = s.conversationsList(r)
+	case "conversations.history":
+		response = s.conversationsHistory(r)
+	case "chat.postMessage":
+		response = s.chatPostMessage(r)
+	case "chat.update":
+		response = s.chatUpdate(r)
+	case "chat.delete":
+		response = s.chatDelete(r)
+	case "users.info":
+		response = s.usersInfo(r)
+	case "emoji.adminList":
+		response = s.emojiAdminList(r)
+	case "views.open":
+		response = s.viewsOpen(r)
+	default:
+		response = errorResponse("unknown_method")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func errorResponse(message string) map[string]interface{} {
+	return map[string]interface{}{"ok": false, "error": message}
+}
+
+// page returns the start and end of the page of a list, and the cursor of the next page.
+func page(r *http.Request, total, defaultLimit int) (int, int, string) {
+	start, _ := strconv.Atoi(r.FormValue("cursor"))
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end >= total {
+		return start, total, ""
+	}
+	return start, end, strconv.Itoa(end)
+}
+
+func (s *Server) conversationsList(r *http.Request) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start, end, cursor := page(r, len(s.channels), 100)
+	return map[string]interface{}{
+		"ok":                true,
+		"channels":          s.channels[start:end],
+		"response_metadata": map[string]string{"next_cursor": cursor},
+	}
+}
+
+func (s *Server) conversationsHistory(r *http.Request) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channelId := r.FormValue("channel")
+	if _, ok := s.history[channelId]; !ok && !s.hasChannel(channelId) {
+		return errorResponse("channel_not_found")
+	}
+	inclusive := r.FormValue("inclusive") == "1"
+	latest, oldest := parseTS(r.FormValue("latest")), parseTS(r.FormValue("oldest"))
+	var messages []slack.Message
+	for _, message := range s.history[channelId] {
+		ts := parseTS(message.Timestamp)
+		if latest != 0 && (ts > latest || (!inclusive && ts == latest)) {
+			continue
+		}
+		if oldest != 0 && (ts < oldest || (!inclusive && ts == oldest)) {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	start, end, cursor := page(r, len(messages), 100)
+	return map[string]interface{}{
+		"ok":                true,
+		"messages":          append([]slack.Message{}, messages[start:end]...),
+		"has_more":          cursor != "",
+		"response_metadata": map[string]string{"next_cursor": cursor},
+	}
+}
+
+func (s *Server) chatPostMessage(r *http.Request) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channel := r.FormValue("channel")
+	if channel == "" {
+		return errorResponse("channel_not_found")
+	}
+	if r.FormValue("text") == "" && r.FormValue("blocks") == "" {
+		return errorResponse("no_text")
+	}
+	posted := PostedMessage{
+		Channel:  channel,
+		Text:     r.FormValue("text"),
+		ThreadTS: r.FormValue("thread_ts"),
+		Blocks:   r.FormValue("blocks"),
+		TS:       s.newTS(),
+	}
+	s.posted = append(s.posted, posted)
+
+	channelId := channel
+	for _, c := range s.channels {
+		if "#"+c.Name == channel || c.Name == channel {
+			channelId = c.ID
+		}
+	}
+	if strings.HasPrefix(channelId, "U") || strings.HasPrefix(channelId, "W") {
+		// Messages to a user go to the DM with that user.
+		channelId = "D" + channelId
+	}
+	if posted.ThreadTS == "" {
+		message := slack.Message{}
+		message.Timestamp = posted.TS
+		message.Text = posted.Text
+		message.Channel = channelId
+		message.User = BotUserID
+		message.BotID = BotID
+		s.addMessage(channelId, message)
+	}
+	return map[string]interface{}{"ok": true, "channel": channelId, "ts": posted.TS}
+}
+
+// findPosted returns the posted message with the timestamp, if it is still there.
+func (s *Server) findPosted(ts string) *PostedMessage {
+	for i := range s.posted {
+		if s.posted[i].TS == ts && !s.posted[i].Deleted {
+			return &s.posted[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) chatUpdate(r *http.Request) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channelId, ts := r.FormValue("channel"), r.FormValue("ts")
+	posted := s.findPosted(ts)
+	if posted == nil {
+		return errorResponse("message_not_found")
+	}
+	if r.FormValue("text") == "" && r.FormValue("blocks") == "" {
+		return errorResponse("no_text")
+	}
+	posted.Text = r.FormValue("text")
+	posted.Blocks = r.FormValue("blocks")
+	posted.Edited = true
+	for i, message := range s.history[channelId] {
+		if message.Timestamp == ts {
+			s.history[channelId][i].Text = posted.Text
+		}
+	}
+	return map[string]interface{}{"ok": true, "channel": channelId, "ts": ts, "text": posted.Text}
+}
+
+func (s *Server) chatDelete(r *http.Request) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channelId, ts := r.FormValue("channel"), r.FormValue("ts")
+	posted := s.findPosted(ts)
+	if posted == nil {
+		return errorResponse("message_not_found")
+	}
+	posted.Deleted = true
+	history := s.history[channelId]
+	for i, message := range history {
+		if message.Timestamp == ts {
+			s.history[channelId] = append(history[:i:i], history[i+1:]...)
+			break
+		}
+	}
+	return map[string]interface{}{"ok": true, "channel": channelId, "ts": ts}
+}
+
+func (s *Server) viewsOpen(r *http.Request) interface{} {
+	var request OpenedView
+	err := json.NewDecoder(r.Body).Decode(&struct {
+		TriggerID *string                 `json:"trigger_id"`
+		View      *slack.ModalViewRequest `json:"view"`
+	}{&request.TriggerID, &request.View})
+	if err != nil {
+		return errorResponse("invalid_json")
+	}
+	if request.TriggerID == "" {
+		return errorResponse("invalid_trigger_id")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.views = append(s.views, request)
+	return map[string]interface{}{"ok": true, "view": map[string]interface{}{"id": fmt.Sprintf("V%d", len(s.views))}}
+}
+
+func (s *Server) usersInfo(r *http.Request) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var users []slack.User
+	for _, id := range strings.Split(r.FormValue("users"), ",") {
+		user, ok := s.users[id]
+		if !ok {
+			return errorResponse("user_not_found")
+		}
+		users = append(users, user)
+	}
+	return map[string]interface{}{"ok": true, "users": users}
+}
+
+func (s *Server) emojiAdminList(r *http.Request) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	emojis := append([]Emoji(nil), s.emojis...)
+	sort.SliceStable(emojis, func(i, j int) bool { return emojis[i].Created > emojis[j].Created })
+	count, err := strconv.Atoi(r.FormValue("count"))
+	if err != nil || count <= 0 {
+		count = 100
+	}
+	pageNumber, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil || pageNumber <= 0 {
+		pageNumber = 1
+	}
+	pages := (len(emojis) + count - 1) / count
+	if pages == 0 {
+		pages = 1
+	}
+	start := (pageNumber - 1) * count
+	if start > len(emojis) {
+		start = len(emojis)
+	}
+	end := start + count
+	if end > len(emojis) {
+		end = len(emojis)
+	}
+	return map[string]interface{}{
+		"ok":                       true,
+		"emoji":                    emojis[start:end],
+		"custom_emoji_total_count": len(emojis),
+		"paging": map[string]int{
+			"count": count,
+			"total": len(emojis),
+			"page":  pageNumber,
+			"pages": pages,
+		},
+	}
+}
+
+func (s *Server) hasChannel(channelId string) bool {
+	for _, channel := range s.channels {
+		if channel.ID == channelId {
+			return true
+		}
+	}
+	return false
+}
+
+// newTS makes a unique message timestamp, like 1700000000.000100.
+func (s *Server) newTS() string {
+	s.nextTS++
+	return fmt.Sprintf("%d.000100", s.nextTS)
+}
+
+func parseTS(ts string) float64 {
+	value, _ := strconv.ParseFloat(ts, 64)
+	return value
+}
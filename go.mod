@@ -5,9 +5,11 @@ go 1.17
 require (
 	golang.org/x/text v0.3.7
 	github.com/slack-go/slack v0.10.1
+	go.etcd.io/bbolt v1.3.9
 )
 
 require (
 	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/sys v0.10.0 // indirect
 )
\ No newline at end of file
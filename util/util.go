@@ -1,5 +1,39 @@
 package util
 
+import (
+	"encoding/json"
+	"sort"
+)
+
 type SetEntry struct{}
 
 type StringSet map[string]SetEntry
+
+// Sorted returns the strings in the set in order.
+func (s StringSet) Sorted() []string {
+	values := make([]string, 0, len(s))
+	for value := range s {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// MarshalJSON writes the set as a sorted list of strings.
+func (s StringSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Sorted())
+}
+
+// UnmarshalJSON reads the set from a list of strings.
+func (s *StringSet) UnmarshalJSON(data []byte) error {
+	var values []string
+	err := json.Unmarshal(data, &values)
+	if err != nil {
+		return err
+	}
+	*s = make(StringSet, len(values))
+	for _, value := range values {
+		(*s)[value] = SetEntry{}
+	}
+	return nil
+}